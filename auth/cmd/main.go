@@ -1,38 +1,135 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"auth/internal/handler"
+	"auth/internal/keys"
+	"auth/internal/middleware"
 	"auth/pkg/auth_user_pb"
+	"auth/pkg/oidc_provider"
+	"jwtauth"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 )
 
 func main() {
-	conn, err := grpc.Dial(os.Getenv("USER_SERVICE_ADDR"), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	serviceToken := os.Getenv("USER_SERVICE_TOKEN")
+	if serviceToken == "" {
+		log.Fatal("USER_SERVICE_TOKEN is not set")
+	}
+	conn, err := grpc.Dial(os.Getenv("USER_SERVICE_ADDR"), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second),
+		grpc.WithPerRPCCredentials(serviceTokenCredentials(serviceToken)))
 	if err != nil {
 		log.Fatalf("failed to connect to the user service: %v", err)
 	}
 	defer conn.Close()
 
+	keySet, err := keys.Load(os.Getenv("JWT_KEYS_DIR"))
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	go keySet.Watch(time.Minute)
+
+	providers, err := oidc_provider.LoadRegistry()
+	if err != nil {
+		log.Fatalf("failed to load OIDC providers: %v", err)
+	}
+
 	authClient := auth_user_pb.NewAuthServiceClient(conn)
-	authHandler := handler.NewAuthHandler(authClient)
+	authHandler := handler.NewAuthHandler(authClient, keySet, providers)
 
 	router := gin.Default()
+	// Failed logins are throttled per client IP, so X-Forwarded-For is only
+	// honoured from the proxies listed in TRUSTED_PROXIES.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// REST endpoints
 	router.POST("/register", authHandler.Register)
 	router.POST("/login", authHandler.Login)
+	router.POST("/login/2fa", authHandler.LoginTwoFactor)
+
+	// Password recovery
+	router.POST("/password/reset/request", authHandler.RequestPasswordReset)
+	router.POST("/password/reset", authHandler.ResetPassword)
+	router.POST("/account/restore", authHandler.RestoreAccount)
+
+	router.POST("/email/verify", authHandler.VerifyEmail)
+
+	router.POST("/token/refresh", authHandler.RefreshToken)
+
+	authorized := router.Group("/")
+	authorized.Use(middleware.AuthMiddleware(jwtauth.NewVerifier(keySet.Keyfunc, jwtauth.AudienceAuth)))
+	{
+		authorized.POST("/password/change", authHandler.ChangePassword)
+		authorized.DELETE("/account", authHandler.DeleteAccount)
+		authorized.POST("/email/verify/resend", authHandler.ResendEmailVerification)
+
+		authorized.POST("/2fa/enroll", authHandler.EnrollTOTP)
+		authorized.POST("/2fa/confirm", authHandler.ConfirmTOTP)
+		authorized.DELETE("/2fa", authHandler.DisableTOTP)
+
+		authorized.POST("/token/exchange", authHandler.ExchangeToken)
+		authorized.POST("/logout", authHandler.Logout)
+		authorized.GET("/sessions", authHandler.GetSessions)
+		authorized.DELETE("/sessions/:id", authHandler.DeleteSession)
+
+		authorized.GET("/google/link", authHandler.GoogleLink)
+		authorized.DELETE("/google/link", authHandler.GoogleUnlink)
+
+		authorized.GET("/oauth/:provider/link", authHandler.OIDCLink)
+		authorized.DELETE("/oauth/:provider/link", authHandler.OIDCUnlink)
+	}
+
+	admin := authorized.Group("/admin")
+	admin.Use(middleware.RequireRole(jwtauth.RoleAdmin))
+	{
+		admin.GET("/users", authHandler.ListUsers)
+		admin.POST("/users/:id/lock", authHandler.LockUser)
+		admin.POST("/users/:id/unlock", authHandler.UnlockUser)
+	}
 
 	// Google OAuth endpoints
 	router.GET("/google/login", authHandler.GoogleLogin)
 	router.GET("/google/callback", authHandler.GoogleCallback)
 
+	// Other OpenID Connect providers, see OIDC_PROVIDERS
+	router.GET("/oauth/:provider/login", authHandler.OIDCLogin)
+	router.GET("/oauth/:provider/callback", authHandler.OIDCCallback)
+
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("failed to launch the server: %v", err)
 	}
 }
+
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// serviceTokenCredentials authenticates the auth service to the user
+// service's AuthService. The channel stays inside the compose network, so
+// the token is sent without TLS.
+type serviceTokenCredentials string
+
+func (t serviceTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t serviceTokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,39 @@
+// Command mockoidc runs the provider from auth/internal/mockoidc.
+//
+// Configuration: MOCK_OIDC_ADDR (default :9000), MOCK_OIDC_ISSUER
+// (default http://localhost:9000), MOCK_OIDC_CLIENT_ID and
+// MOCK_OIDC_CLIENT_SECRET (default tasker / secret).
+package main
+
+import (
+	"auth/internal/mockoidc"
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+func env(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	s, err := mockoidc.New(
+		env("MOCK_OIDC_ISSUER", "http://localhost:9000"),
+		env("MOCK_OIDC_CLIENT_ID", "tasker"),
+		env("MOCK_OIDC_CLIENT_SECRET", "secret"),
+	)
+	if err != nil {
+		log.Fatalf("failed to generate key: %v", err)
+	}
+
+	router := gin.Default()
+	s.Register(router)
+
+	if err := router.Run(env("MOCK_OIDC_ADDR", ":9000")); err != nil {
+		log.Fatalf("failed to launch the server: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// DeleteAccount schedules the account for deletion after re-checking the
+// password. Accounts without a password send a two-factor code instead or
+// must have logged in recently. The account and its tasks are removed once
+// the grace period is over; until then RestoreAccount can undo it.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	res, err := h.authClient.DeleteAccount(c, &auth_user_pb.DeleteAccountRequest{
+		Id:        uint64(userID),
+		Password:  input.Password,
+		SessionId: uint64(c.GetUint("sessionID")),
+		Code:      input.Code,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Account scheduled for deletion",
+		"deletion_due_at": time.Unix(res.DeletionDueAt, 0).UTC(),
+	})
+}
+
+func (h *AuthHandler) RestoreAccount(c *gin.Context) {
+	var input struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	res, err := h.authClient.RestoreAccount(c, &auth_user_pb.RestoreAccountRequest{
+		Username: input.Username,
+		Password: input.Password,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored", "id": res.Id})
+}
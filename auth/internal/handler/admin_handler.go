@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	var query struct {
+		Query   string `form:"query"`
+		AfterID uint64 `form:"after_id"`
+		Limit   int32  `form:"limit"`
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	res, err := h.authClient.ListUsers(c, &auth_user_pb.ListUsersRequest{
+		ActorId: uint64(c.GetUint("userID")),
+		Query:   query.Query,
+		AfterId: query.AfterID,
+		Limit:   query.Limit,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	users := make([]gin.H, 0, len(res.Users))
+	for _, user := range res.Users {
+		item := gin.H{
+			"id":       user.Id,
+			"username": user.Username,
+			"email":    user.Email,
+			"name":     user.Name,
+			"role":     user.Role,
+		}
+		if user.LockedAt != 0 {
+			item["locked_at"] = time.Unix(user.LockedAt, 0).UTC()
+		}
+		if user.DeletionDueAt != 0 {
+			item["deletion_due_at"] = time.Unix(user.DeletionDueAt, 0).UTC()
+		}
+		if user.FailedLogins != 0 {
+			item["failed_logins"] = user.FailedLogins
+		}
+		if user.LoginBlockedUntil != 0 {
+			item["login_blocked_until"] = time.Unix(user.LoginBlockedUntil, 0).UTC()
+		}
+		users = append(users, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func (h *AuthHandler) LockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid_request", "invalid user id")
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional, so an empty body is fine.
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(c, err)
+		return
+	}
+
+	_, err = h.authClient.LockUser(c, &auth_user_pb.LockUserRequest{
+		ActorId: uint64(c.GetUint("userID")),
+		UserId:  userID,
+		Reason:  input.Reason,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User locked"})
+}
+
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid_request", "invalid user id")
+		return
+	}
+
+	_, err = h.authClient.UnlockUser(c, &auth_user_pb.UnlockUserRequest{
+		ActorId: uint64(c.GetUint("userID")),
+		UserId:  userID,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
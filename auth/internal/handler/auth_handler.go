@@ -1,31 +1,24 @@
 package handler
 
 import (
+	"auth/internal/keys"
 	"auth/pkg/auth_user_pb"
-	"github.com/dgrijalva/jwt-go"
+	"auth/pkg/oidc_provider"
 	"github.com/gin-gonic/gin"
-	"log"
+	"jwtauth"
 	"net/http"
 	"os"
 	"time"
 )
 
-var jwtSecret []byte
-
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
-	}
-	jwtSecret = []byte(secret)
-}
-
 type AuthHandler struct {
 	authClient auth_user_pb.AuthServiceClient
+	keys       *keys.KeySet
+	providers  *oidc_provider.Registry
 }
 
-func NewAuthHandler(authClient auth_user_pb.AuthServiceClient) *AuthHandler {
-	return &AuthHandler{authClient: authClient}
+func NewAuthHandler(authClient auth_user_pb.AuthServiceClient, keySet *keys.KeySet, providers *oidc_provider.Registry) *AuthHandler {
+	return &AuthHandler{authClient: authClient, keys: keySet, providers: providers}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -36,17 +29,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	if input.Username == "" || input.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		badRequest(c, err)
 		return
 	}
 
+	// Username and password rules are enforced by the user service.
 	if input.RepeatPassword != input.Password {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
+		validationFailed(c, fieldError("repeat_password", "mismatch", "passwords do not match"))
 		return
 	}
 
@@ -57,12 +46,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	res, err := h.authClient.Register(c, grpcReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{"error": res.Error})
+		rpcFailure(c, err)
 		return
 	}
 
@@ -77,51 +61,60 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err)
 		return
 	}
 
 	if input.Username == "" || input.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		fail(c, http.StatusBadRequest, "invalid_request", "Username and password are required")
 		return
 	}
 
 	grpcReq := &auth_user_pb.LoginRequest{
 		Username: input.Username,
 		Password: input.Password,
+		Ip:       c.ClientIP(),
 	}
 
 	res, err := h.authClient.Login(c, grpcReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error: " + err.Error()})
+		rpcFailure(c, err)
 		return
 	}
 
-	if !res.Success {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": res.Error})
-		return
-	}
-
-	token, err := generateJWT(uint(res.Id))
+	tokens, err := h.completeLogin(c, res.Id, res.TwoFactorRequired, res.LoginTicket, "Login successful")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		fail(c, http.StatusInternalServerError, "internal", "failed to generate token")
 		return
 	}
+	c.JSON(http.StatusOK, tokens)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":   token,
-		"message": "Login successful",
-		"id":      res.Id,
-	})
-
+// accessTokenTTL is kept short: a revoked session stays usable only until
+// its last access token expires.
+func accessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
 }
 
-func generateJWT(id uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": id,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(), // Life of token 72 hours
+// generateJWT mints an access token for a single audience. Only that
+// service accepts it, and within it only the given scopes.
+func (h *AuthHandler) generateJWT(id, sessionID uint, audience string, ttl time.Duration, roles, scopes []string, emailVerified bool) (string, error) {
+	claims, err := jwtauth.NewClaims(id, ttl, audience)
+	if err != nil {
+		return "", err
 	}
+	claims.SessionID = sessionID
+	claims.Roles = roles
+	claims.Scopes = scopes
+	claims.EmailVerified = emailVerified
+	return h.keys.Sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+// JWKS publishes the public keys other services use to verify access tokens.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.keys.JWKS()})
 }
@@ -4,68 +4,158 @@ import (
 	"auth/pkg/auth_user_pb"
 	"auth/pkg/google_oauth"
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 	"io"
 	"net/http"
 )
 
+// googleProvider names the Google flow in the OAuth state cookie. Google
+// keeps its own routes; other providers go through /oauth/:provider.
+const googleProvider = "google"
+
+type googleUser struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name"`
+}
+
+// verifiedEmail returns the email only if Google has verified it, so an
+// unverified address can never be matched against our accounts.
+func (u *googleUser) verifiedEmail() string {
+	if !u.VerifiedEmail {
+		return ""
+	}
+	return u.Email
+}
+
+// beginFailure reports a flow that could not be started.
+func beginFailure(c *gin.Context, err error) {
+	if errors.Is(err, errRedirectNotAllowed) {
+		fail(c, http.StatusBadRequest, "redirect_not_allowed", err.Error())
+		return
+	}
+	fail(c, http.StatusInternalServerError, "internal", "failed to start OAuth flow")
+}
+
 func (h *AuthHandler) GoogleLogin(c *gin.Context) {
-	url := google_oauth.GoogleOAuthConfig.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	st, err := h.beginOAuth(c, googleProvider, 0, c.Query("redirect_uri"))
+	if err != nil {
+		beginFailure(c, err)
+		return
+	}
+
+	url := google_oauth.GoogleOAuthConfig.AuthCodeURL(st.State, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(st.Verifier))
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
-func (h *AuthHandler) GoogleCallback(c *gin.Context) {
-	code := c.Query("code")
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Code not found in callback"})
+// GoogleLink starts the Google flow for linking the current user's account.
+// The caller is authenticated by header, so the URL is returned rather than
+// redirected to; the state cookie is set on this response.
+func (h *AuthHandler) GoogleLink(c *gin.Context) {
+	st, err := h.beginOAuth(c, googleProvider, c.GetUint("userID"), c.Query("redirect_uri"))
+	if err != nil {
+		beginFailure(c, err)
 		return
 	}
 
-	token, err := google_oauth.GoogleOAuthConfig.Exchange(c, code)
+	url := google_oauth.GoogleOAuthConfig.AuthCodeURL(st.State, oauth2.S256ChallengeOption(st.Verifier))
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func (h *AuthHandler) GoogleUnlink(c *gin.Context) {
+	_, err := h.authClient.UnlinkGoogle(c, &auth_user_pb.UnlinkGoogleRequest{
+		UserId: uint64(c.GetUint("userID")),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token exchange failed"})
+		rpcFailure(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "Google account unlinked"})
+}
+
+func fetchGoogleUser(c *gin.Context, code, verifier string) (*googleUser, error) {
+	token, err := google_oauth.GoogleOAuthConfig.Exchange(c, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, errors.New("Token exchange failed")
+	}
+
 	client := google_oauth.GoogleOAuthConfig.Client(c, token)
 	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
 	if err != nil || resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
-		return
+		return nil, errors.New("Failed to get user info")
 	}
 	defer resp.Body.Close()
 
 	data, _ := io.ReadAll(resp.Body)
-	var userInfo struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
+	var userInfo googleUser
+	if err := json.Unmarshal(data, &userInfo); err != nil || userInfo.ID == "" {
+		return nil, errors.New("Invalid user info response")
+	}
+	return &userInfo, nil
+}
+
+func (h *AuthHandler) GoogleCallback(c *gin.Context) {
+	st, err := h.finishOAuth(c, googleProvider)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid_oauth_state", err.Error())
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		st.respond(c, http.StatusBadRequest, errorBody("invalid_request", "Code not found in callback"))
+		return
+	}
+
+	userInfo, err := fetchGoogleUser(c, code, st.Verifier)
+	if err != nil {
+		st.respond(c, http.StatusBadGateway, errorBody("provider_error", err.Error()))
+		return
 	}
-	if err := json.Unmarshal(data, &userInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user info response"})
+
+	if linkUserID := st.linkUserID(); linkUserID != 0 {
+		h.linkGoogle(c, st, linkUserID, userInfo)
 		return
 	}
 
 	res, err := h.authClient.LoginWithGoogle(c, &auth_user_pb.GoogleLoginRequest{
 		GoogleId: userInfo.ID,
-		Email:    userInfo.Email,
+		Email:    userInfo.verifiedEmail(),
 		Name:     userInfo.Name,
 	})
-	if err != nil || !res.Success {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Auth failed"})
+	if err != nil {
+		// email_taken: an existing account owns this email and its owner
+		// has to link Google.
+		status, body := rpcError(err)
+		st.respond(c, status, body)
 		return
 	}
 
-	jwtToken, err := generateJWT(uint(res.Id))
+	tokens, err := h.completeLogin(c, res.Id, res.TwoFactorRequired, res.LoginTicket, "Google login successful")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT generation failed"})
+		st.respond(c, http.StatusInternalServerError, errorBody("internal", "JWT generation failed"))
 		return
 	}
+	st.respond(c, http.StatusOK, tokens)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":   jwtToken,
-		"message": "Google login successful",
-		"id":      res.Id,
+func (h *AuthHandler) linkGoogle(c *gin.Context, st *oauthState, userID uint, userInfo *googleUser) {
+	_, err := h.authClient.LinkGoogle(c, &auth_user_pb.LinkGoogleRequest{
+		UserId:    uint64(userID),
+		GoogleId:  userInfo.ID,
+		Email:     userInfo.verifiedEmail(),
+		Name:      userInfo.Name,
+		SessionId: uint64(st.SessionID),
 	})
+	if err != nil {
+		status, body := rpcError(err)
+		st.respond(c, status, body)
+		return
+	}
+
+	st.respond(c, http.StatusOK, gin.H{"message": "Google account linked"})
 }
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// VerifyEmail confirms the address the token was sent to. It needs no JWT:
+// the token itself proves the user read the email.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	res, err := h.authClient.VerifyEmail(c, &auth_user_pb.VerifyEmailRequest{Token: input.Token})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	// Tokens issued before now still say unverified until they are refreshed.
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", "id": res.UserId})
+}
+
+// ResendEmailVerification sends another verification email to the
+// signed-in user, at most once a minute.
+func (h *AuthHandler) ResendEmailVerification(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	_, err := h.authClient.SendEmailVerification(c, &auth_user_pb.SendEmailVerificationRequest{
+		UserId: uint64(userID),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Every error response has the same envelope:
+//
+//	{"error": "invalid username or password", "code": "invalid_credentials"}
+//
+// code is machine-readable and error is meant for people. Validation errors
+// add "fields", throttled requests add "retry_after" in seconds.
+
+// fieldViolation is one broken rule of a request field.
+type fieldViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// fieldError builds a violation for checks done in the auth service
+// itself; the codes match the ones the user service returns.
+func fieldError(field, code, message string) fieldViolation {
+	return fieldViolation{Field: field, Code: code, Message: message}
+}
+
+func errorBody(code, message string) gin.H {
+	return gin.H{"error": message, "code": code}
+}
+
+func fail(c *gin.Context, status int, code, message string) {
+	c.JSON(status, errorBody(code, message))
+}
+
+// badRequest rejects a body or query that could not be parsed.
+func badRequest(c *gin.Context, err error) {
+	fail(c, http.StatusBadRequest, "invalid_request", err.Error())
+}
+
+// validationFailed answers 400 with one entry per broken rule.
+func validationFailed(c *gin.Context, violations ...fieldViolation) {
+	body := errorBody("validation_failed", "validation failed")
+	body["fields"] = violations
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// rpcStatuses gives the HTTP status and the fallback code for the gRPC
+// codes the user service uses. The code is replaced by the ErrorInfo
+// reason when there is one.
+var rpcStatuses = map[codes.Code]struct {
+	status int
+	code   string
+}{
+	codes.InvalidArgument:    {http.StatusBadRequest, "invalid_argument"},
+	codes.Unauthenticated:    {http.StatusUnauthorized, "unauthenticated"},
+	codes.PermissionDenied:   {http.StatusForbidden, "permission_denied"},
+	codes.NotFound:           {http.StatusNotFound, "not_found"},
+	codes.AlreadyExists:      {http.StatusConflict, "already_exists"},
+	codes.FailedPrecondition: {http.StatusConflict, "failed_precondition"},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, "too_many_requests"},
+}
+
+// rpcError translates a failed user service call into a response. Other
+// failures are logged and reported without their details.
+func rpcError(err error) (int, gin.H) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		log.Printf("user service: %v", err)
+		return http.StatusServiceUnavailable, errorBody("unavailable", "user service is unavailable")
+	}
+
+	mapped, ok := rpcStatuses[st.Code()]
+	if !ok {
+		log.Printf("user service: %v", err)
+		return http.StatusInternalServerError, errorBody("internal", "internal error")
+	}
+
+	body := errorBody(mapped.code, st.Message())
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			body["code"] = strings.ToLower(d.Reason)
+		case *errdetails.BadRequest:
+			fields := make([]fieldViolation, 0, len(d.FieldViolations))
+			for _, v := range d.FieldViolations {
+				fields = append(fields, fieldError(v.Field, v.Reason, v.Description))
+			}
+			body["fields"] = fields
+		case *errdetails.RetryInfo:
+			body["retry_after"] = int64(d.RetryDelay.AsDuration().Seconds())
+		}
+	}
+	return mapped.status, body
+}
+
+// rpcFailure answers with the translated error of a user service call.
+func rpcFailure(c *gin.Context, err error) {
+	status, body := rpcError(err)
+	if retryAfter, ok := body["retry_after"].(int64); ok {
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+	c.JSON(status, body)
+}
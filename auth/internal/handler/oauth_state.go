@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"jwtauth"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	stateCookie   = "oauth_state"
+	stateTTL      = 10 * time.Minute
+	stateAudience = "auth:oauth-state"
+)
+
+var (
+	errInvalidState       = errors.New("invalid or expired OAuth state")
+	errRedirectNotAllowed = errors.New("redirect_uri is not allowed")
+)
+
+// oauthState is what the auth service remembers between sending the user
+// to the provider and the callback. It travels in a signed cookie, so the
+// callback only succeeds in the browser that started the flow.
+type oauthState struct {
+	jwtauth.Claims
+	Provider    string `json:"provider"`
+	State       string `json:"state"`
+	Verifier    string `json:"verifier"`
+	Nonce       string `json:"nonce"`
+	RedirectURI string `json:"redirect_uri,omitempty"`
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// redirectAllowed checks a post-login redirect against OAUTH_REDIRECT_ALLOWLIST,
+// a comma-separated list of exact URLs.
+func redirectAllowed(redirectURI string) bool {
+	for _, allowed := range strings.Split(os.Getenv("OAUTH_REDIRECT_ALLOWLIST"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && allowed == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// beginOAuth creates a fresh state, PKCE verifier and nonce for a flow with
+// the provider and stores them in the state cookie. linkUserID is set when
+// a signed-in user links an identity; their session goes into the state as
+// well, and the user service checks it is still active when linking.
+func (h *AuthHandler) beginOAuth(c *gin.Context, provider string, linkUserID uint, redirectURI string) (*oauthState, error) {
+	if redirectURI != "" && !redirectAllowed(redirectURI) {
+		return nil, errRedirectNotAllowed
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	claims, err := jwtauth.NewClaims(linkUserID, stateTTL, stateAudience)
+	if err != nil {
+		return nil, err
+	}
+	if linkUserID != 0 {
+		claims.SessionID = c.GetUint("sessionID")
+	}
+
+	st := &oauthState{
+		Claims:      *claims,
+		Provider:    provider,
+		State:       state,
+		Verifier:    oauth2.GenerateVerifier(),
+		Nonce:       nonce,
+		RedirectURI: redirectURI,
+	}
+	signed, err := h.keys.Sign(st)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, signed, int(stateTTL.Seconds()), "/", "", true, true)
+	return st, nil
+}
+
+// finishOAuth checks the callback's state and provider against the cookie
+// and clears it.
+func (h *AuthHandler) finishOAuth(c *gin.Context, provider string) (*oauthState, error) {
+	cookie, err := c.Cookie(stateCookie)
+	if err != nil {
+		return nil, errInvalidState
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, "", -1, "/", "", true, true)
+
+	st := &oauthState{}
+	if _, err := jwt.ParseWithClaims(cookie, st, h.keys.Keyfunc); err != nil {
+		return nil, errInvalidState
+	}
+	if st.Issuer != jwtauth.Issuer || !st.Audience.Contains(stateAudience) || st.Provider != provider {
+		return nil, errInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(st.State), []byte(c.Query("state"))) != 1 {
+		return nil, errInvalidState
+	}
+	return st, nil
+}
+
+// linkUserID returns the user who started a linking flow, or 0 for a login.
+func (st *oauthState) linkUserID() uint {
+	id, _ := st.UserID()
+	return id
+}
+
+// respond sends the outcome of a flow: as JSON, or, if the flow was started
+// with a redirect_uri, as a redirect carrying the fields in the fragment so
+// they never reach server logs.
+func (st *oauthState) respond(c *gin.Context, status int, body gin.H) {
+	if st == nil || st.RedirectURI == "" {
+		c.JSON(status, body)
+		return
+	}
+
+	values := url.Values{}
+	for key, value := range body {
+		values.Set(key, fmt.Sprint(value))
+	}
+	c.Redirect(http.StatusFound, st.RedirectURI+"#"+values.Encode())
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"auth/pkg/oidc_provider"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// provider resolves the :provider route parameter. Google has its own
+// routes and is not served here.
+func (h *AuthHandler) provider(c *gin.Context) (*oidc_provider.Provider, bool) {
+	name := c.Param("provider")
+	p, err := h.providers.Get(c, name)
+	if err != nil {
+		if errors.Is(err, oidc_provider.ErrUnknownProvider) {
+			fail(c, http.StatusNotFound, "unknown_provider", err.Error())
+			return nil, false
+		}
+		log.Printf("OIDC provider %s: %v", name, err)
+		fail(c, http.StatusBadGateway, "provider_unavailable", "provider is unavailable")
+		return nil, false
+	}
+	return p, true
+}
+
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	st, err := h.beginOAuth(c, p.Name, 0, c.Query("redirect_uri"))
+	if err != nil {
+		beginFailure(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, p.AuthCodeURL(st.State, st.Verifier, st.Nonce))
+}
+
+// OIDCLink starts linking a provider account to the current user; like
+// GoogleLink it returns the URL instead of redirecting.
+func (h *AuthHandler) OIDCLink(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	st, err := h.beginOAuth(c, p.Name, c.GetUint("userID"), c.Query("redirect_uri"))
+	if err != nil {
+		beginFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": p.AuthCodeURL(st.State, st.Verifier, st.Nonce)})
+}
+
+func (h *AuthHandler) OIDCUnlink(c *gin.Context) {
+	_, err := h.authClient.UnlinkOIDC(c, &auth_user_pb.UnlinkOIDCRequest{
+		UserId:   uint64(c.GetUint("userID")),
+		Provider: c.Param("provider"),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+}
+
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	p, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	st, err := h.finishOAuth(c, p.Name)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid_oauth_state", err.Error())
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		st.respond(c, http.StatusUnauthorized, errorBody("provider_error", errCode))
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		st.respond(c, http.StatusBadRequest, errorBody("invalid_request", "Code not found in callback"))
+		return
+	}
+
+	identity, err := p.Exchange(c, code, st.Verifier, st.Nonce)
+	if err != nil {
+		log.Printf("OIDC provider %s: %v", p.Name, err)
+		st.respond(c, http.StatusUnauthorized, errorBody("invalid_id_token", "ID token validation failed"))
+		return
+	}
+
+	// Only a verified email may be matched against our accounts.
+	email := ""
+	if identity.EmailVerified {
+		email = identity.Email
+	}
+
+	if linkUserID := st.linkUserID(); linkUserID != 0 {
+		_, err := h.authClient.LinkOIDC(c, &auth_user_pb.LinkOIDCRequest{
+			UserId:    uint64(linkUserID),
+			Provider:  p.Name,
+			Subject:   identity.Subject,
+			Email:     email,
+			Name:      identity.Name,
+			SessionId: uint64(st.SessionID),
+		})
+		if err != nil {
+			status, body := rpcError(err)
+			st.respond(c, status, body)
+			return
+		}
+		st.respond(c, http.StatusOK, gin.H{"message": "Account linked"})
+		return
+	}
+
+	res, err := h.authClient.LoginWithOIDC(c, &auth_user_pb.OIDCLoginRequest{
+		Provider: p.Name,
+		Subject:  identity.Subject,
+		Email:    email,
+		Name:     identity.Name,
+	})
+	if err != nil {
+		status, body := rpcError(err)
+		st.respond(c, status, body)
+		return
+	}
+
+	tokens, err := h.completeLogin(c, res.Id, res.TwoFactorRequired, res.LoginTicket, "Login successful")
+	if err != nil {
+		st.respond(c, http.StatusInternalServerError, errorBody("internal", "failed to generate token"))
+		return
+	}
+	st.respond(c, http.StatusOK, tokens)
+}
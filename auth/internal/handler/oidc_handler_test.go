@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"auth/internal/keys"
+	"auth/internal/mockoidc"
+	"auth/pkg/auth_user_pb"
+	"auth/pkg/oidc_provider"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"jwtauth"
+)
+
+// fakeAuthClient answers the calls of an OIDC login; any other call panics.
+type fakeAuthClient struct {
+	auth_user_pb.AuthServiceClient
+	login   *auth_user_pb.OIDCLoginRequest
+	session *auth_user_pb.CreateSessionRequest
+}
+
+func (f *fakeAuthClient) LoginWithOIDC(_ context.Context, in *auth_user_pb.OIDCLoginRequest, _ ...grpc.CallOption) (*auth_user_pb.OIDCLoginResponse, error) {
+	f.login = in
+	return &auth_user_pb.OIDCLoginResponse{Id: 42, LoginTicket: "ticket"}, nil
+}
+
+func (f *fakeAuthClient) CreateSession(_ context.Context, in *auth_user_pb.CreateSessionRequest, _ ...grpc.CallOption) (*auth_user_pb.CreateSessionResponse, error) {
+	f.session = in
+	return &auth_user_pb.CreateSessionResponse{SessionId: 7, RefreshToken: "refresh", Roles: []string{jwtauth.RoleUser}}, nil
+}
+
+type oidcFlow struct {
+	router *gin.Engine
+	client *fakeAuthClient
+	keys   *keys.KeySet
+	// browser talks to the provider and does not follow redirects.
+	browser *http.Client
+}
+
+func newOIDCFlow(t *testing.T) *oidcFlow {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	provider, err := mockoidc.New("", "tasker", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerRouter := gin.New()
+	provider.Register(providerRouter)
+	server := httptest.NewServer(providerRouter)
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	t.Setenv("OIDC_PROVIDERS_FILE", "")
+	t.Setenv("OIDC_PROVIDERS", fmt.Sprintf(
+		`{"providers": [{"name": "mock", "issuer": %q, "client_id": "tasker", "client_secret": "secret", "redirect_url": "http://auth.test/oauth/mock/callback"}]}`,
+		server.URL))
+	registry, err := oidc_provider.LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := keys.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeAuthClient{}
+	h := NewAuthHandler(client, keySet, registry)
+	router := gin.New()
+	router.GET("/oauth/:provider/login", h.OIDCLogin)
+	router.GET("/oauth/:provider/callback", h.OIDCCallback)
+
+	return &oidcFlow{
+		router: router,
+		client: client,
+		keys:   keySet,
+		browser: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+func (f *oidcFlow) serve(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// start begins a login and signs in at the provider. It returns the state
+// cookie and the callback query the provider redirected to.
+func (f *oidcFlow) start(t *testing.T) (*http.Cookie, url.Values) {
+	t.Helper()
+	w := f.serve("/oauth/mock/login")
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookie {
+		t.Fatalf("login set cookies %v", cookies)
+	}
+
+	resp, err := f.browser.Get(w.Header().Get("Location") + "&login_hint=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return cookies[0], callback.Query()
+}
+
+func TestOIDCCallbackLogin(t *testing.T) {
+	f := newOIDCFlow(t)
+	cookie, query := f.start(t)
+
+	w := f.serve("/oauth/mock/callback?"+query.Encode(), cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ID           uint64 `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ID != 42 || body.RefreshToken != "refresh" {
+		t.Errorf("body = %s", w.Body)
+	}
+	claims, err := jwtauth.NewVerifier(f.keys.Keyfunc, jwtauth.AudienceAuth).Parse(body.Token)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	if claims.Subject != "42" || claims.SessionID != 7 {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	login := f.client.login
+	if login == nil || login.Provider != "mock" || login.Subject != "alice" || login.Email != "alice@mock.local" {
+		t.Errorf("LoginWithOIDC got %+v", login)
+	}
+	if session := f.client.session; session == nil || session.UserId != 42 || session.LoginTicket != "ticket" {
+		t.Errorf("CreateSession got %+v", session)
+	}
+}
+
+func TestOIDCCallbackRejectsState(t *testing.T) {
+	f := newOIDCFlow(t)
+	cookie, query := f.start(t)
+
+	tampered := url.Values{"code": {query.Get("code")}, "state": {query.Get("state") + "x"}}
+	other, _ := f.start(t)
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		cookies []*http.Cookie
+	}{
+		{"state mismatch", tampered, []*http.Cookie{cookie}},
+		{"no state cookie", query, nil},
+		{"cookie from another flow", query, []*http.Cookie{other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.serve("/oauth/mock/callback?"+tt.query.Encode(), tt.cookies...)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "invalid_oauth_state" {
+				t.Errorf("body = %s", w.Body)
+			}
+			if f.client.login != nil {
+				t.Error("user service was called")
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var input struct {
+		OldPassword    string `json:"old_password"`
+		NewPassword    string `json:"new_password"`
+		RepeatPassword string `json:"repeat_password"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if input.OldPassword == "" {
+		validationFailed(c, fieldError("old_password", "required", "old password is required"))
+		return
+	}
+
+	if input.RepeatPassword != input.NewPassword {
+		validationFailed(c, fieldError("repeat_password", "mismatch", "passwords do not match"))
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	_, err := h.authClient.ChangePassword(c, &auth_user_pb.ChangePasswordRequest{
+		Id:          uint64(userID),
+		OldPassword: input.OldPassword,
+		NewPassword: input.NewPassword,
+		SessionId:   uint64(c.GetUint("sessionID")),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// RequestPasswordReset always answers the same way, whether or not the
+// user exists. The token is delivered out of band by the user service.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var input struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	_, err := h.authClient.RequestPasswordReset(c, &auth_user_pb.RequestPasswordResetRequest{
+		Username: input.Username,
+		Ip:       c.ClientIP(),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a reset token has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token          string `json:"token" binding:"required"`
+		NewPassword    string `json:"new_password" binding:"required"`
+		RepeatPassword string `json:"repeat_password"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if input.RepeatPassword != input.NewPassword {
+		validationFailed(c, fieldError("repeat_password", "mismatch", "passwords do not match"))
+		return
+	}
+
+	_, err := h.authClient.ResetPassword(c, &auth_user_pb.ResetPasswordRequest{
+		Token:       input.Token,
+		NewPassword: input.NewPassword,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
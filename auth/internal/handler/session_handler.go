@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"github.com/gin-gonic/gin"
+	"jwtauth"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// startSession opens a session for a freshly authenticated user and returns
+// the token pair to send back.
+func (h *AuthHandler) startSession(c *gin.Context, userID uint64, loginTicket string) (gin.H, error) {
+	res, err := h.authClient.CreateSession(c, &auth_user_pb.CreateSessionRequest{
+		UserId:      userID,
+		UserAgent:   c.Request.UserAgent(),
+		Ip:          c.ClientIP(),
+		LoginTicket: loginTicket,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.tokenPair(userID, res.SessionId, res.RefreshToken, res.Roles, res.EmailVerified)
+}
+
+// tokenPair's access token is for the auth service; tokens for the other
+// services are obtained with ExchangeToken.
+func (h *AuthHandler) tokenPair(userID, sessionID uint64, refreshToken string, roles []string, emailVerified bool) (gin.H, error) {
+	audience := jwtauth.AudienceAuth
+	token, err := h.generateJWT(uint(userID), uint(sessionID), audience, accessTokenTTL(), roles, jwtauth.ScopesFor(audience, roles), emailVerified)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The old
+// refresh token stops working; presenting it again revokes the session.
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	res, err := h.authClient.RefreshSession(c, &auth_user_pb.RefreshSessionRequest{
+		RefreshToken: input.RefreshToken,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	tokens, err := h.tokenPair(res.UserId, res.SessionId, res.RefreshToken, res.Roles, res.EmailVerified)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, "internal", "failed to generate token")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ExchangeToken trades the caller's auth token for one accepted by the task
+// or the user service, optionally narrowed to some of the scopes the
+// caller's roles grant there. The new token expires no later than the one
+// presented, so a revoked session still ends within one access token TTL.
+func (h *AuthHandler) ExchangeToken(c *gin.Context) {
+	var input struct {
+		Audience string   `json:"audience" binding:"required"`
+		Scopes   []string `json:"scopes"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if input.Audience != jwtauth.AudienceTask && input.Audience != jwtauth.AudienceUser {
+		validationFailed(c, fieldError("audience", "invalid", "audience must be task or user"))
+		return
+	}
+
+	claims := c.MustGet("claims").(*jwtauth.Claims)
+	scopes := jwtauth.ScopesFor(input.Audience, claims.Roles)
+	if len(input.Scopes) > 0 {
+		for _, scope := range input.Scopes {
+			if !slices.Contains(scopes, scope) {
+				validationFailed(c, fieldError("scopes", "not_granted", "scope not granted: "+scope))
+				return
+			}
+		}
+		scopes = input.Scopes
+	}
+
+	ttl := min(accessTokenTTL(), time.Until(time.Unix(claims.ExpiresAt, 0)))
+	token, err := h.generateJWT(c.GetUint("userID"), claims.SessionID, input.Audience, ttl, claims.Roles, scopes, claims.EmailVerified)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, "internal", "failed to generate token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"audience":   input.Audience,
+		"scopes":     scopes,
+		"expires_in": int64(ttl.Seconds()),
+	})
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	h.revokeSession(c, c.GetUint("sessionID"))
+}
+
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	res, err := h.authClient.ListSessions(c, &auth_user_pb.ListSessionsRequest{
+		UserId: uint64(c.GetUint("userID")),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	current := uint64(c.GetUint("sessionID"))
+	sessions := make([]gin.H, 0, len(res.Sessions))
+	for _, session := range res.Sessions {
+		sessions = append(sessions, gin.H{
+			"id":           session.Id,
+			"user_agent":   session.UserAgent,
+			"ip":           session.Ip,
+			"created_at":   time.Unix(session.CreatedAt, 0).UTC(),
+			"last_used_at": time.Unix(session.LastUsedAt, 0).UTC(),
+			"expires_at":   time.Unix(session.ExpiresAt, 0).UTC(),
+			"current":      session.Id == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *AuthHandler) DeleteSession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid_request", "invalid session id")
+		return
+	}
+	h.revokeSession(c, uint(sessionID))
+}
+
+func (h *AuthHandler) revokeSession(c *gin.Context, sessionID uint) {
+	_, err := h.authClient.RevokeSession(c, &auth_user_pb.RevokeSessionRequest{
+		UserId:    uint64(c.GetUint("userID")),
+		SessionId: uint64(sessionID),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"auth/pkg/auth_user_pb"
+	"github.com/gin-gonic/gin"
+	"jwtauth"
+	"net/http"
+	"time"
+)
+
+const (
+	challengeTTL      = 5 * time.Minute
+	challengeAudience = "auth:2fa-challenge"
+)
+
+// completeLogin finishes a successful first login step. Without 2FA it
+// starts a session right away with the login ticket the user service
+// issued; with 2FA it only hands out a short-lived challenge token that
+// LoginTwoFactor exchanges for the real tokens.
+func (h *AuthHandler) completeLogin(c *gin.Context, userID uint64, twoFactorRequired bool, loginTicket, message string) (gin.H, error) {
+	if !twoFactorRequired {
+		tokens, err := h.startSession(c, userID, loginTicket)
+		if err != nil {
+			return nil, err
+		}
+		tokens["message"] = message
+		tokens["id"] = userID
+		return tokens, nil
+	}
+
+	claims, err := jwtauth.NewClaims(uint(userID), challengeTTL, challengeAudience)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := h.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_in":          int64(challengeTTL.Seconds()),
+	}, nil
+}
+
+// LoginTwoFactor exchanges a challenge token and a TOTP or recovery code
+// for a token pair.
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	claims, err := jwtauth.NewVerifier(h.keys.Keyfunc, challengeAudience).Parse(input.ChallengeToken)
+	if err != nil {
+		fail(c, http.StatusUnauthorized, "invalid_challenge_token", "invalid or expired challenge token")
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		fail(c, http.StatusUnauthorized, "invalid_challenge_token", "invalid or expired challenge token")
+		return
+	}
+
+	res, err := h.authClient.VerifyTwoFactor(c, &auth_user_pb.VerifyTwoFactorRequest{
+		UserId: uint64(userID),
+		Code:   input.Code,
+		Ip:     c.ClientIP(),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	tokens, err := h.completeLogin(c, uint64(userID), false, res.LoginTicket, "Login successful")
+	if err != nil {
+		fail(c, http.StatusInternalServerError, "internal", "failed to generate token")
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTOTP starts 2FA enrollment and returns the secret and otpauth URI
+// to show as a QR code.
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	res, err := h.authClient.EnrollTOTP(c, &auth_user_pb.EnrollTOTPRequest{
+		UserId:    uint64(userID),
+		SessionId: uint64(c.GetUint("sessionID")),
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": res.Secret, "otpauth_uri": res.Uri})
+}
+
+// ConfirmTOTP enables 2FA with a code from the authenticator and returns
+// the recovery codes. They are shown only once.
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	res, err := h.authClient.ConfirmTOTP(c, &auth_user_pb.ConfirmTOTPRequest{
+		UserId: uint64(userID),
+		Code:   input.Code,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": res.RecoveryCodes,
+	})
+}
+
+// DisableTOTP turns 2FA off; it takes the password and a current code.
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	_, err := h.authClient.DisableTOTP(c, &auth_user_pb.DisableTOTPRequest{
+		UserId:   uint64(userID),
+		Password: input.Password,
+		Code:     input.Code,
+	})
+	if err != nil {
+		rpcFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
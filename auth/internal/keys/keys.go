@@ -0,0 +1,166 @@
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeySet holds the RSA keys used to sign access tokens. Keys are read from a
+// directory of PEM files named <kid>.pem. The key with the greatest kid signs
+// new tokens; the others are only published so that tokens they signed keep
+// verifying until the file is removed. Naming keys by date (2026-10-18.pem)
+// makes a rotation as simple as adding a file and, once the old tokens have
+// expired, deleting the previous one.
+type KeySet struct {
+	dir string
+
+	mu     sync.RWMutex
+	active string
+	keys   map[string]*rsa.PrivateKey
+}
+
+// Load reads the keys from dir. With an empty dir a single key is generated
+// in memory, which is only suitable for development: tokens do not survive
+// a restart.
+func Load(dir string) (*KeySet, error) {
+	ks := &KeySet{dir: dir}
+	if dir == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		kid := time.Now().UTC().Format("20060102150405")
+		ks.active = kid
+		ks.keys = map[string]*rsa.PrivateKey{kid: key}
+		return ks, nil
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key directory. On error the current keys are kept.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PrivateKey, len(paths))
+	kids := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		keys[kid] = key
+		kids = append(kids, kid)
+	}
+	if len(kids) == 0 {
+		return errors.New("no signing keys in " + ks.dir)
+	}
+	sort.Strings(kids)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.active = kids[len(kids)-1]
+	return nil
+}
+
+// Watch reloads the keys every interval so that rotation does not require
+// a restart.
+func (ks *KeySet) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := ks.Reload(); err != nil {
+			log.Printf("failed to reload signing keys: %v", err)
+		}
+	}
+}
+
+// Sign signs the claims with the active key and records its kid in the header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	kid, key := ks.active, ks.keys[ks.active]
+	ks.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// Keyfunc resolves the verification key of a token by its kid.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodRS256 {
+		return nil, errors.New("unexpected signing method")
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	return &key.PublicKey, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS returns the public halves of all keys, the active one first.
+func (ks *KeySet) JWKS() []JWK {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(kids)))
+
+	jwks := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		pub := ks.keys[kid].PublicKey
+		jwks = append(jwks, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return jwks
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwtauth"
+	"net/http"
+)
+
+func AuthMiddleware(verifier *jwtauth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := jwtauth.BearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "invalid_token"})
+			return
+		}
+
+		claims, err := verifier.Parse(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "invalid_token"})
+			return
+		}
+		userID, _ := claims.UserID()
+
+		c.Set("userID", userID)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// RequireRole lets the request through only if the access token carries role.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*jwtauth.Claims)
+		if !ok || !claims.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role", "code": "insufficient_role"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,196 @@
+// Package mockoidc is a minimal OpenID Connect provider for running the
+// /oauth/:provider flow locally and in tests without network access. It
+// signs every user in without asking: the subject comes from the login_hint
+// parameter of the authorization request, or "mock-user" by default.
+package mockoidc
+
+import (
+	"auth/internal/keys"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+type authRequest struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	subject     string
+	expiresAt   time.Time
+}
+
+// Server is the provider. Issuer may be set after New, once the address
+// is known, but before the first request.
+type Server struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// IDTokenClaims, if set, may change the ID token claims before signing,
+	// to produce tokens that must be rejected.
+	IDTokenClaims func(jwt.MapClaims)
+
+	keys  *keys.KeySet
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+// New creates a provider signing with a key generated in memory.
+func New(issuer, clientID, clientSecret string) (*Server, error) {
+	keySet, err := keys.Load("")
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		keys:         keySet,
+		codes:        make(map[string]authRequest),
+	}, nil
+}
+
+// Register adds the discovery, authorization, token and JWKS endpoints.
+func (s *Server) Register(router gin.IRoutes) {
+	router.GET("/.well-known/openid-configuration", s.discovery)
+	router.GET("/authorize", s.authorize)
+	router.POST("/token", s.token)
+	router.GET("/jwks", s.jwks)
+}
+
+func randomHex() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func (s *Server) discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": s.keys.JWKS()})
+}
+
+func (s *Server) authorize(c *gin.Context) {
+	if c.Query("client_id") != s.ClientID || c.Query("response_type") != "code" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+	if c.Query("code_challenge_method") != "S256" || c.Query("code_challenge") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "PKCE S256 required"})
+		return
+	}
+	redirect, err := url.Parse(c.Query("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "bad redirect_uri"})
+		return
+	}
+
+	code, err := randomHex()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	s.mu.Lock()
+	s.codes[code] = authRequest{
+		clientID:    s.ClientID,
+		redirectURI: c.Query("redirect_uri"),
+		nonce:       c.Query("nonce"),
+		challenge:   c.Query("code_challenge"),
+		subject:     c.DefaultQuery("login_hint", "mock-user"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", c.Query("state"))
+	redirect.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, redirect.String())
+}
+
+func (s *Server) token(c *gin.Context) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if clientID != s.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+	if c.PostForm("grant_type") != "authorization_code" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Codes are single use.
+	s.mu.Lock()
+	req, ok := s.codes[c.PostForm("code")]
+	delete(s.codes, c.PostForm("code"))
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(req.expiresAt) || req.redirectURI != c.PostForm("redirect_uri") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(c.PostForm("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.Issuer,
+		"sub":            req.subject,
+		"aud":            req.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          req.nonce,
+		"email":          req.subject + "@mock.local",
+		"email_verified": true,
+		"name":           "Mock " + req.subject,
+	}
+	if s.IDTokenClaims != nil {
+		s.IDTokenClaims(claims)
+	}
+	idToken, err := s.keys.Sign(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	accessToken, err := randomHex()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
@@ -0,0 +1,170 @@
+package oidc_provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown OIDC provider")
+	ErrMissingIDToken  = errors.New("provider did not return an ID token")
+	ErrNonceMismatch   = errors.New("ID token nonce does not match")
+)
+
+// Config describes one provider. ClientSecretEnv names an environment
+// variable holding the secret, so the file itself can be kept in git.
+type Config struct {
+	Name            string   `json:"name"`
+	Issuer          string   `json:"issuer"`
+	ClientID        string   `json:"client_id"`
+	ClientSecret    string   `json:"client_secret"`
+	ClientSecretEnv string   `json:"client_secret_env"`
+	RedirectURL     string   `json:"redirect_url"`
+	Scopes          []string `json:"scopes"`
+}
+
+// Provider is a discovered provider ready for the authorization code flow.
+type Provider struct {
+	Name     string
+	OAuth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Identity is what we take from a validated ID token.
+type Identity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Registry holds the configured providers. Discovery runs on first use, so
+// the service starts even while a provider is unreachable.
+type Registry struct {
+	configs map[string]Config
+
+	mu        sync.Mutex
+	providers map[string]*Provider
+}
+
+// LoadRegistry reads provider configs as JSON ({"providers": [...]}) from
+// the file named by OIDC_PROVIDERS_FILE or, failing that, from OIDC_PROVIDERS.
+func LoadRegistry() (*Registry, error) {
+	data := []byte(os.Getenv("OIDC_PROVIDERS"))
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Registry{
+		configs:   make(map[string]Config),
+		providers: make(map[string]*Provider),
+	}
+	if len(data) == 0 {
+		return r, nil
+	}
+
+	var file struct {
+		Providers []Config `json:"providers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid OIDC provider config: %w", err)
+	}
+	for _, cfg := range file.Providers {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, errors.New("OIDC provider needs name, issuer and client_id")
+		}
+		if cfg.ClientSecret == "" && cfg.ClientSecretEnv != "" {
+			cfg.ClientSecret = os.Getenv(cfg.ClientSecretEnv)
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"email", "profile"}
+		}
+		r.configs[cfg.Name] = cfg
+	}
+	return r, nil
+}
+
+// Get returns the named provider, running issuer discovery if needed.
+// Discovery runs without the lock, so a slow or unreachable issuer does not
+// hold up the other providers; concurrent first calls may both discover,
+// and the first result is kept.
+func (r *Registry) Get(ctx context.Context, name string) (*Provider, error) {
+	cfg, ok := r.configs[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	r.mu.Lock()
+	p, ok := r.providers[name]
+	r.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	discovered, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovery for %s failed: %w", name, err)
+	}
+
+	p = &Provider{
+		Name: name,
+		OAuth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.providers[name]; ok {
+		return existing, nil
+	}
+	r.providers[name] = p
+	return p, nil
+}
+
+// AuthCodeURL builds the login URL with PKCE and a nonce bound to the ID token.
+func (p *Provider) AuthCodeURL(state, verifier, nonce string) string {
+	return p.OAuth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+}
+
+// Exchange redeems the code and validates the ID token: signature, issuer,
+// audience, expiry and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := p.OAuth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	var identity Identity
+	if err := idToken.Claims(&identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
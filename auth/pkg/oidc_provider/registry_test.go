@@ -0,0 +1,200 @@
+package oidc_provider
+
+import (
+	"auth/internal/mockoidc"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const redirectURL = "http://auth.test/oauth/mock/callback"
+
+// startProvider runs a mock provider and points OIDC_PROVIDERS at it under
+// the name "mock". discoveries counts the discovery requests it served.
+func startProvider(t *testing.T) (provider *mockoidc.Server, discoveries *atomic.Int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	provider, err := mockoidc.New("", "tasker", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	discoveries = new(atomic.Int32)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.Request.URL.Path == "/.well-known/openid-configuration" {
+			discoveries.Add(1)
+		}
+	})
+	provider.Register(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	t.Setenv("OIDC_PROVIDERS_FILE", "")
+	t.Setenv("OIDC_PROVIDERS", fmt.Sprintf(
+		`{"providers": [{"name": "mock", "issuer": %q, "client_id": "tasker", "client_secret": "secret", "redirect_url": %q}]}`,
+		server.URL, redirectURL))
+	return provider, discoveries
+}
+
+func loadProvider(t *testing.T) *Provider {
+	t.Helper()
+	registry, err := LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := registry.Get(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// authorize runs the authorization request as a browser that signs in
+// right away would, and returns the code from the redirect to us.
+func authorize(t *testing.T, p *Provider, state, verifier, nonce string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(p.AuthCodeURL(state, verifier, nonce) + "&login_hint=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if !strings.HasPrefix(location.String(), redirectURL) || location.Query().Get("state") != state {
+		t.Fatalf("redirected to %s", location)
+	}
+	return location.Query().Get("code")
+}
+
+func TestRegistryDiscovery(t *testing.T) {
+	provider, discoveries := startProvider(t)
+	registry, err := LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Get(context.Background(), "other"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("unknown provider: error = %v", err)
+	}
+
+	p, err := registry.Get(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.OAuth.Endpoint.AuthURL != provider.Issuer+"/authorize" || p.OAuth.Endpoint.TokenURL != provider.Issuer+"/token" {
+		t.Errorf("endpoint = %+v", p.OAuth.Endpoint)
+	}
+	if got := strings.Join(p.OAuth.Scopes, " "); got != "openid email profile" {
+		t.Errorf("scopes = %q", got)
+	}
+
+	again, err := registry.Get(context.Background(), "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != p || discoveries.Load() != 1 {
+		t.Errorf("second Get ran discovery again (%d discoveries)", discoveries.Load())
+	}
+}
+
+func TestRegistryDiscoveryRetried(t *testing.T) {
+	_, discoveries := startProvider(t)
+	registry, err := LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed discovery is not remembered.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := registry.Get(ctx, "mock"); err == nil {
+		t.Fatal("discovery with a cancelled context succeeded")
+	}
+	if _, err := registry.Get(context.Background(), "mock"); err != nil {
+		t.Fatal(err)
+	}
+	if discoveries.Load() != 1 {
+		t.Errorf("%d discoveries reached the provider, want 1", discoveries.Load())
+	}
+}
+
+func TestExchange(t *testing.T) {
+	startProvider(t)
+	p := loadProvider(t)
+
+	verifier := oauth2.GenerateVerifier()
+	code := authorize(t, p, "state", verifier, "nonce")
+
+	identity, err := p.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "alice", Email: "alice@mock.local", EmailVerified: true, Name: "Mock alice"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// Codes are single use.
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Error("code redeemed twice")
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   func(jwt.MapClaims)
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{name: "nonce mismatch", nonce: "other", wantErr: ErrNonceMismatch},
+		{name: "PKCE verifier mismatch", verifier: oauth2.GenerateVerifier()},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := startProvider(t)
+			provider.IDTokenClaims = tt.claims
+			p := loadProvider(t)
+
+			verifier := oauth2.GenerateVerifier()
+			code := authorize(t, p, "state", verifier, "nonce")
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			identity, err := p.Exchange(context.Background(), code, verifier, nonce)
+			if err == nil {
+				t.Fatalf("accepted: %+v", identity)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
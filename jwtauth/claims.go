@@ -0,0 +1,163 @@
+// Package jwtauth holds the access token format shared by all services:
+// typed claims, their validation and key lookup via the auth service JWKS.
+package jwtauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Issuer is the iss of every token minted by the auth service.
+const Issuer = "tasker-auth"
+
+// Audiences, one per service. A token is accepted only by the services
+// listed in its aud; the auth service mints each access token for one.
+const (
+	AudienceAuth = "auth"
+	AudienceTask = "task"
+	AudienceUser = "user"
+)
+
+// Roles carried in the roles claim.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Scopes of task tokens. A token that lists scopes is limited to them.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeAdminTasks = "admin:tasks:read"
+)
+
+// audienceScopes gives, per audience, the scopes each role may hold.
+// Audiences without an entry use no scopes.
+var audienceScopes = map[string]map[string][]string{
+	AudienceTask: {
+		RoleUser:  {ScopeTasksRead, ScopeTasksWrite},
+		RoleAdmin: {ScopeTasksRead, ScopeTasksWrite, ScopeAdminTasks},
+	},
+}
+
+var (
+	ErrTokenExpired    = errors.New("token is expired")
+	ErrTokenNotYet     = errors.New("token used before issued")
+	ErrInvalidIssuer   = errors.New("invalid token issuer")
+	ErrInvalidAudience = errors.New("token is not intended for this service")
+	ErrInvalidSubject  = errors.New("invalid token subject")
+)
+
+// Claims is the payload of an access token.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	ID        string   `json:"jti"`
+	SessionID uint     `json:"sid,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// EmailVerified tells whether the user has confirmed their email address.
+	EmailVerified bool `json:"email_verified,omitempty"`
+}
+
+// NewClaims fills in the registered claims for a token issued to userID now.
+func NewClaims(userID uint, ttl time.Duration, audience ...string) (*Claims, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Claims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Issuer:    Issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		ID:        hex.EncodeToString(jti),
+	}, nil
+}
+
+// Valid checks the time-based claims; it is called by jwt.ParseWithClaims.
+func (c *Claims) Valid() error {
+	now := time.Now().Unix()
+	if now >= c.ExpiresAt {
+		return ErrTokenExpired
+	}
+	if c.IssuedAt > now {
+		return ErrTokenNotYet
+	}
+	return nil
+}
+
+// UserID returns the subject as a user id.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidSubject
+	}
+	return uint(id), nil
+}
+
+// ScopesFor returns the scopes roles grant on audience. No roles means
+// RoleUser.
+func ScopesFor(audience string, roles []string) []string {
+	if len(roles) == 0 {
+		roles = []string{RoleUser}
+	}
+	var scopes []string
+	for _, role := range roles {
+		for _, scope := range audienceScopes[audience][role] {
+			if !contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+func (c *Claims) HasRole(role string) bool {
+	return contains(c.Roles, role)
+}
+
+// Audience is the aud claim. RFC 7519 allows both a single string and an
+// array; it is always written as an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	return contains(a, audience)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
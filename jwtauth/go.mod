@@ -0,0 +1,5 @@
+module jwtauth
+
+go 1.24
+
+require github.com/dgrijalva/jwt-go v3.2.0+incompatible
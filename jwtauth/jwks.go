@@ -0,0 +1,160 @@
+package jwtauth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// cacheTTL is how long fetched keys are trusted before they are refetched.
+	cacheTTL = 10 * time.Minute
+	// minRefetch limits refetches triggered by tokens with an unknown kid,
+	// so garbage tokens cannot turn into a flood of requests to the auth service.
+	minRefetch = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWKSClient verifies access tokens against the keys published by the auth
+// service at /.well-known/jwks.json. Keys are cached; a token signed with an
+// unknown kid triggers a refetch, which is how a key rotation is picked up.
+// Only one fetch runs at a time, and it does not hold up tokens whose key
+// is already cached.
+type JWKSClient struct {
+	url  string
+	http *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// refreshing is closed when the running fetch finishes; nil if none runs.
+	refreshing chan struct{}
+	fetchErr   error
+}
+
+func NewJWKSClient(url string) *JWKSClient {
+	return &JWKSClient{
+		url:  url,
+		http: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Keyfunc resolves the verification key of a token by its kid.
+func (c *JWKSClient) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodRS256 {
+		return nil, errors.New("unexpected signing method")
+	}
+	kid, _ := token.Header["kid"].(string)
+	return c.key(kid)
+}
+
+func (c *JWKSClient) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+	if ok || age < minRefetch {
+		// A stale key keeps being served while fresh keys are fetched, and
+		// also if the auth service is unavailable.
+		if ok && age >= cacheTTL {
+			c.refresh()
+		}
+		c.mu.Unlock()
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		return key, nil
+	}
+	done := c.refresh()
+	c.mu.Unlock()
+
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if c.fetchErr != nil {
+		return nil, c.fetchErr
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh starts a fetch unless one is already running and returns a
+// channel that is closed when it finishes. c.mu must be held.
+func (c *JWKSClient) refresh() <-chan struct{} {
+	if c.refreshing != nil {
+		return c.refreshing
+	}
+	done := make(chan struct{})
+	c.refreshing = done
+	go func() {
+		keys, err := c.fetch()
+
+		c.mu.Lock()
+		if err == nil {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.fetchErr = err
+		c.refreshing = nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (c *JWKSClient) fetch() (map[string]*rsa.PublicKey, error) {
+	resp, err := c.http.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,88 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer publishes key under kid "k1". Requests block until release
+// is closed; fetches counts them.
+func jwksServer(t *testing.T, key *rsa.PublicKey, release <-chan struct{}) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	fetches := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {{
+			Kty: "RSA",
+			Kid: "k1",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server, fetches
+}
+
+func TestJWKSClientServesStaleKeyDuringRefresh(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	server, fetches := jwksServer(t, &private.PublicKey, release)
+
+	c := NewJWKSClient(server.URL)
+	c.keys = map[string]*rsa.PublicKey{"k1": &private.PublicKey}
+	c.fetchedAt = time.Now().Add(-cacheTTL)
+
+	// The fetch blocks on the server, yet cached keys are answered at once
+	// and only one fetch is started.
+	for i := 0; i < 3; i++ {
+		if key, err := c.key("k1"); err != nil || key != &private.PublicKey {
+			t.Fatalf("key = %v, %v", key, err)
+		}
+	}
+	close(release)
+
+	// Right after the fetch an unknown kid is refused without another one.
+	c.mu.Lock()
+	done := c.refreshing
+	c.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d fetches, want 1", n)
+	}
+	if _, err := c.key("k2"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown kid: error = %v", err)
+	}
+}
+
+func TestJWKSClientFetchesUnknownKey(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	close(release)
+	server, _ := jwksServer(t, &private.PublicKey, release)
+
+	key, err := NewJWKSClient(server.URL).key("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.N.Cmp(private.N) != 0 || key.E != private.E {
+		t.Error("fetched key differs from the published one")
+	}
+}
@@ -0,0 +1,60 @@
+package jwtauth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Verifier checks tokens presented to one service.
+type Verifier struct {
+	keyfunc  jwt.Keyfunc
+	audience string
+}
+
+// NewVerifier returns a verifier for the given audience that looks up
+// signing keys with keyfunc.
+func NewVerifier(keyfunc jwt.Keyfunc, audience string) *Verifier {
+	return &Verifier{keyfunc: keyfunc, audience: audience}
+}
+
+// Parse verifies the signature, expiry, issuer and audience of a token.
+func (v *Verifier) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.keyfunc)
+	if err != nil {
+		// Unwrap validation errors so callers see ErrTokenExpired and friends.
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Inner != nil {
+			return nil, validationErr.Inner
+		}
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.Issuer != Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if !claims.Audience.Contains(v.audience) {
+		return nil, ErrInvalidAudience
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// BearerToken extracts the token from an Authorization header value.
+func BearerToken(header string) (string, error) {
+	if header == "" {
+		return "", errors.New("Authorization header required")
+	}
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return "", errors.New("Authorization must be in 'Bearer <token>' format")
+	}
+	return strings.TrimPrefix(header, prefix), nil
+}
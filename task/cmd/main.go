@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"jwtauth"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"task/internal/handler"
 	"task/internal/middleware"
 	"task/internal/model"
+	"task/internal/usercache"
+	"task/pkg/taskpb"
 	"task/pkg/userpb"
+	"task/transport"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -18,30 +27,88 @@ func main() {
 		log.Fatal(err)
 	}
 
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	userAddr := os.Getenv("USER_SERVICE_ADDR")
+	if userAddr == "" {
+		userAddr = "localhost:50051"
+	}
+	conn, err := grpc.NewClient(userAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("failed to connect to the user service: %v", err)
 	}
 	defer conn.Close()
 	userClient := userpb.NewUserServiceClient(conn)
+	userCache := usercache.NewFromEnv(userClient)
+	go userCache.Watch(context.Background())
+
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL is not set")
+	}
+	verifier := jwtauth.NewVerifier(jwtauth.NewJWKSClient(jwksURL).Keyfunc, jwtauth.AudienceTask)
+
+	grpcServer := grpc.NewServer()
+	taskpb.RegisterTaskServiceServer(grpcServer, transport.NewTaskServiceServer(db))
 
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET is not set")
+	listener, err := net.Listen("tcp", ":50052")
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
 	}
+	go func() {
+		log.Println("Starting gRPC server on :50052")
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	// Metrics are served on a separate listener, on localhost unless
+	// DEBUG_ADDR says otherwise, so they are not exposed with the API.
+	debugAddr := os.Getenv("DEBUG_ADDR")
+	if debugAddr == "" {
+		debugAddr = "localhost:6060"
+	}
+	debugMux := http.NewServeMux()
+	debugMux.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		log.Printf("Serving /debug/vars on %s", debugAddr)
+		if err := http.ListenAndServe(debugAddr, debugMux); err != nil {
+			log.Printf("debug listener stopped: %v", err)
+		}
+	}()
 
 	r := gin.Default()
 
-	authMiddleware := middleware.AuthMiddleware(secret, userClient)
+	authMiddleware := middleware.AuthMiddleware(verifier, userCache)
 
 	taskHandler := handler.NewTaskHandler(db, userClient)
 
+	read := middleware.RequirePermission(middleware.PermTasksRead)
+	write := middleware.RequirePermission(middleware.PermTasksWrite)
+
 	authorized := r.Group("/")
 	authorized.Use(authMiddleware)
 	{
-		authorized.GET("/tasks", taskHandler.GetTasks)
-		authorized.POST("/tasks", taskHandler.AddTask)
-		authorized.DELETE("/tasks", taskHandler.DeleteTask)
+		authorized.GET("/tasks", read, taskHandler.GetTasks)
+		authorized.POST("/tasks", write, taskHandler.AddTask)
+		authorized.GET("/tasks/:id", read, taskHandler.GetTask)
+		authorized.PATCH("/tasks/:id", write, taskHandler.UpdateTask)
+		authorized.PUT("/tasks/:id", write, taskHandler.ReplaceTask)
+		authorized.DELETE("/tasks/:id", write, taskHandler.DeleteTask)
+		authorized.POST("/tasks/:id/complete", write, taskHandler.CompleteTask)
+		authorized.POST("/tasks/:id/reopen", write, taskHandler.ReopenTask)
+		authorized.GET("/tasks/:id/occurrences", read, taskHandler.GetOccurrences)
+		authorized.GET("/tasks/:id/collaborators", read, taskHandler.GetCollaborators)
+		authorized.POST("/tasks/:id/collaborators", write, taskHandler.AddCollaborator)
+		authorized.DELETE("/tasks/:id/collaborators/:userId", write, taskHandler.RemoveCollaborator)
+		authorized.POST("/tasks/:id/tags/:tagId", write, taskHandler.AttachTag)
+		authorized.DELETE("/tasks/:id/tags/:tagId", write, taskHandler.DetachTag)
+
+		authorized.GET("/tags", read, taskHandler.GetTags)
+		authorized.POST("/tags", write, taskHandler.AddTag)
+		authorized.PATCH("/tags/:tagId", write, taskHandler.UpdateTag)
+		authorized.DELETE("/tags/:tagId", write, taskHandler.DeleteTag)
+
+		authorized.GET("/admin/users/:userId/tasks",
+			middleware.RequirePermission(middleware.PermAdminTasks), taskHandler.GetUserTasks)
 	}
 
 	if err := r.Run(":8081"); err != nil {
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// GetUserTasks lets an admin see another user's tasks for support purposes.
+func (h *TaskHandler) GetUserTasks(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.s.ListUserTasks(adminID, uint(targetID), filter)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	h.attachOwners(page)
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"task/internal/model"
+	"task/pkg/userpb"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *TaskHandler) GetCollaborators(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	collaborators, err := h.s.GetCollaborators(taskID, userID)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collaborators": h.withUsers(collaborators)})
+}
+
+// AddCollaborator invites a user by username. The username is resolved
+// through the user service.
+func (h *TaskHandler) AddCollaborator(c *gin.Context) {
+	var input struct {
+		Username string     `json:"username" binding:"required"`
+		Role     model.Role `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.userClient.GetUserByUsername(context.Background(), &userpb.GetUserByUsernameRequest{
+		Username: input.Username,
+	})
+	if err != nil {
+		// The name matches several old accounts in different case.
+		if st, ok := status.FromError(err); ok && st.Code() == codes.FailedPrecondition {
+			c.JSON(http.StatusConflict, gin.H{"error": st.Message()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to look up user"})
+		return
+	}
+	if !resp.Exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	collaborator, err := h.s.ShareTask(taskID, userID, uint(resp.Id), input.Role)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collaborator": collaborator, "username": input.Username})
+}
+
+func (h *TaskHandler) RemoveCollaborator(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	collaboratorID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.s.RevokeAccess(taskID, userID, uint(collaboratorID)); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "access revoked", "task_id": taskID, "user_id": collaboratorID})
+}
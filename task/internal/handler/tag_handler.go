@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"task/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseTagID(c *gin.Context) (uint, bool) {
+	tagID, err := strconv.ParseUint(c.Param("tagId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag id"})
+		return 0, false
+	}
+	return uint(tagID), true
+}
+
+func (h *TaskHandler) GetTags(c *gin.Context) {
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.s.GetTags(userID)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func (h *TaskHandler) AddTag(c *gin.Context) {
+	var input struct {
+		Name  string `json:"name" binding:"required"`
+		Color string `json:"color"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	tag := model.Tag{UserID: userID, Name: input.Name, Color: input.Color}
+	if err := h.s.CreateTag(&tag); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tag": tag})
+}
+
+func (h *TaskHandler) UpdateTag(c *gin.Context) {
+	var input struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tagID, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	tag, err := h.s.UpdateTag(tagID, userID, input.Name, input.Color)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag updated successfully", "tag": tag})
+}
+
+func (h *TaskHandler) DeleteTag(c *gin.Context) {
+	tagID, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.s.DeleteTag(tagID, userID); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag deleted successfully", "id": tagID})
+}
+
+func (h *TaskHandler) AttachTag(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	tagID, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.s.AttachTag(taskID, tagID, userID); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag attached", "task_id": taskID, "tag_id": tagID})
+}
+
+func (h *TaskHandler) DetachTag(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	tagID, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.s.DetachTag(taskID, tagID, userID); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag detached", "task_id": taskID, "tag_id": tagID})
+}
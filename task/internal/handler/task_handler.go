@@ -1,7 +1,8 @@
 package handler
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"net/http"
@@ -24,6 +25,7 @@ func NewTaskHandler(db *gorm.DB, userClient userpb.UserServiceClient) *TaskHandl
 	}
 }
 
+// validateUser returns the user AuthMiddleware has already checked.
 func (h *TaskHandler) validateUser(c *gin.Context) (uint, bool) {
 
 	userIDVal, exists := c.Get("userID")
@@ -38,30 +40,132 @@ func (h *TaskHandler) validateUser(c *gin.Context) (uint, bool) {
 		return 0, false
 	}
 
-	resp, err := h.userClient.GetUser(context.Background(), &userpb.GetUserRequest{
-		Id: strconv.Itoa(int(userID)),
-	})
-	if err != nil || !resp.Exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+	return userID, true
+}
+
+func parseTaskID(c *gin.Context) (uint, bool) {
+	taskID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
 		return 0, false
 	}
+	return uint(taskID), true
+}
 
-	return userID, true
+// writeServiceError maps service errors onto HTTP statuses.
+func writeServiceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrCollaboratorNotFound),
+		errors.Is(err, service.ErrParentNotFound), errors.Is(err, service.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTaskForbidden), errors.Is(err, service.ErrCreatorOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTagNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmptyTitle), errors.Is(err, service.ErrDeadlineInPast),
+		errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidRecurrence), errors.Is(err, service.ErrRecurrenceNeedsDeadline),
+		errors.Is(err, service.ErrTaskNotRecurring), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrCollaboratorIsCreator), errors.Is(err, service.ErrInvalidPriority),
+		errors.Is(err, service.ErrSubtaskTooDeep), errors.Is(err, service.ErrSubtaskCycle),
+		errors.Is(err, service.ErrSubtaskOwnerChanged), errors.Is(err, service.ErrInvalidTagName),
+		errors.Is(err, service.ErrInvalidTagColor), errors.Is(err, service.ErrInvalidTagMode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 func (h *TaskHandler) GetTasks(c *gin.Context) {
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userID, ok := h.validateUser(c)
 	if !ok {
 		return
 	}
 
-	tasks, err := h.s.GetTaskByUser(userID)
+	page, err := h.s.ListTasks(userID, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
+		return
+	}
+	h.attachOwners(page)
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseTaskFilter reads the GET /tasks query string.
+func parseTaskFilter(c *gin.Context) (service.TaskFilter, error) {
+	filter := service.TaskFilter{
+		Query:   c.Query("q"),
+		Tags:    c.QueryArray("tag"),
+		TagMode: service.TagMode(c.Query("tag_mode")),
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+	}
+
+	if v := c.Query("is_ready"); v != "" {
+		isReady, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid is_ready: %q", v)
+		}
+		filter.IsReady = &isReady
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit: %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	times := []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"due_before", &filter.DueBefore},
+		{"due_after", &filter.DueAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"created_after", &filter.CreatedAfter},
+	}
+	for _, t := range times {
+		v := c.Query(t.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: expected RFC3339 time", t.name)
+		}
+		*t.dst = &parsed
+	}
+
+	return filter, nil
+}
+
+func (h *TaskHandler) GetTask(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	task, role, err := h.s.GetTaskTree(taskID, userID)
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, tasks)
+	c.JSON(http.StatusOK, gin.H{"task": task, "role": role})
 }
 
 func (h *TaskHandler) AddTask(c *gin.Context) {
@@ -79,7 +183,7 @@ func (h *TaskHandler) AddTask(c *gin.Context) {
 	newTask.UserID = userID
 
 	if err := h.s.CreateTask(&newTask); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeServiceError(c, err)
 		return
 	}
 
@@ -87,8 +191,35 @@ func (h *TaskHandler) AddTask(c *gin.Context) {
 }
 
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.validateUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.s.DeleteTask(taskID, userID); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "task deleted successfully", "id": taskID})
+}
+
+// UpdateTask handles PATCH: only the fields present in the body are changed.
+func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	var input struct {
-		ID uint `json:"id" binding:"required"`
+		Title        *string         `json:"title"`
+		Description  *string         `json:"description"`
+		Deadline     *time.Time      `json:"deadline"`
+		IsReady      *bool           `json:"is_ready"`
+		RRule        *string         `json:"rrule"`
+		Priority     *model.Priority `json:"priority"`
+		ParentID     *uint           `json:"parent_id"`
+		AutoComplete *bool           `json:"auto_complete"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -96,24 +227,45 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+
 	userID, ok := h.validateUser(c)
 	if !ok {
 		return
 	}
 
-	if err := h.s.DeleteTask(input.ID, userID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	task, err := h.s.UpdateTask(taskID, userID, service.TaskPatch{
+		Title:        input.Title,
+		Description:  input.Description,
+		Deadline:     input.Deadline,
+		IsReady:      input.IsReady,
+		RRule:        input.RRule,
+		Priority:     input.Priority,
+		ParentID:     input.ParentID,
+		AutoComplete: input.AutoComplete,
+	})
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "task deleted successfully", "id": input.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully", "task": task})
 }
 
-func (h *TaskHandler) UpdateTask(c *gin.Context) {
+// ReplaceTask handles PUT: the body is the full new state of the task.
+func (h *TaskHandler) ReplaceTask(c *gin.Context) {
 	var input struct {
-		Title       string     `json:"title"`
-		Description string     `json:"description"`
-		Deadline    *time.Time `json:"deadline"`
+		Title        string         `json:"title" binding:"required"`
+		Description  string         `json:"description"`
+		Deadline     *time.Time     `json:"deadline"`
+		IsReady      bool           `json:"is_ready"`
+		RRule        string         `json:"rrule"`
+		Priority     model.Priority `json:"priority"`
+		ParentID     uint           `json:"parent_id"`
+		AutoComplete bool           `json:"auto_complete"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -121,10 +273,8 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
-	taskIDStr := c.Param("id")
-	taskID, err := strconv.ParseUint(taskIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+	taskID, ok := parseTaskID(c)
+	if !ok {
 		return
 	}
 
@@ -133,40 +283,83 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
-	if err = h.s.UpdateTask(uint(taskID), userID, input.Title, input.Description, input.Deadline); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	task, err := h.s.ReplaceTask(taskID, userID, service.TaskFields{
+		Title:        input.Title,
+		Description:  input.Description,
+		Deadline:     input.Deadline,
+		IsReady:      input.IsReady,
+		RRule:        input.RRule,
+		Priority:     input.Priority,
+		ParentID:     input.ParentID,
+		AutoComplete: input.AutoComplete,
+	})
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully", "task": task})
 }
 
-func (h *TaskHandler) UpdateStateTask(c *gin.Context) {
-	var input struct {
-		IsReady bool `json:"is_ready" binding:"required"`
+func (h *TaskHandler) CompleteTask(c *gin.Context) {
+	h.UpdateStateTask(c, true)
+}
+
+func (h *TaskHandler) ReopenTask(c *gin.Context) {
+	h.UpdateStateTask(c, false)
+}
+
+func (h *TaskHandler) UpdateStateTask(c *gin.Context, isReady bool) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	userID, ok := h.validateUser(c)
+	if !ok {
 		return
 	}
 
-	taskIDStr := c.Param("id")
-	taskID, err := strconv.ParseUint(taskIDStr, 10, 64)
+	task, next, err := h.s.UpdateStateTask(taskID, userID, isReady)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		writeServiceError(c, err)
+		return
+	}
+
+	response := gin.H{"message": "task state updated successfully", "task": task}
+	if next != nil {
+		response["next_task"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetOccurrences previews the upcoming deadlines of a recurring task.
+func (h *TaskHandler) GetOccurrences(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
 		return
 	}
 
+	count := 10
+	if v := c.Query("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > service.MaxPreviewOccurrences {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", service.MaxPreviewOccurrences)})
+			return
+		}
+		count = n
+	}
+
 	userID, ok := h.validateUser(c)
 	if !ok {
 		return
 	}
 
-	if err = h.s.UpdateStateTask(uint(taskID), userID, input.IsReady); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	occurrences, err := h.s.UpcomingOccurrences(taskID, userID, count)
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "task state updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"id": taskID, "occurrences": occurrences})
 }
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"task/internal/model"
+	"task/internal/service"
+	"task/pkg/userpb"
+)
+
+// lookupUsers resolves user IDs with a single BatchGetUsers call. Names are
+// only decoration, so a failed lookup is logged and yields an empty map.
+func (h *TaskHandler) lookupUsers(ids []uint) map[uint]*service.UserRef {
+	refs := make(map[uint]*service.UserRef, len(ids))
+	if len(ids) == 0 {
+		return refs
+	}
+
+	seen := make(map[uint]bool, len(ids))
+	req := &userpb.BatchGetUsersRequest{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			req.Ids = append(req.Ids, uint64(id))
+		}
+	}
+
+	resp, err := h.userClient.BatchGetUsers(context.Background(), req)
+	if err != nil {
+		log.Printf("failed to look up %d users: %v", len(req.Ids), err)
+		return refs
+	}
+	for _, u := range resp.Users {
+		refs[uint(u.Id)] = &service.UserRef{
+			ID:          uint(u.Id),
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+		}
+	}
+	return refs
+}
+
+// attachOwners fills in the owner of every task in the page.
+func (h *TaskHandler) attachOwners(page *service.TaskPage) {
+	ids := make([]uint, 0, len(page.Tasks))
+	for _, task := range page.Tasks {
+		ids = append(ids, task.UserID)
+	}
+	owners := h.lookupUsers(ids)
+	for i := range page.Tasks {
+		page.Tasks[i].Owner = owners[page.Tasks[i].UserID]
+	}
+}
+
+// collaboratorView is a collaborator together with the user's name.
+type collaboratorView struct {
+	model.Collaborator
+	User *service.UserRef `json:"user,omitempty"`
+}
+
+func (h *TaskHandler) withUsers(collaborators []model.Collaborator) []collaboratorView {
+	ids := make([]uint, 0, len(collaborators))
+	for _, collaborator := range collaborators {
+		ids = append(ids, collaborator.UserID)
+	}
+	users := h.lookupUsers(ids)
+
+	views := make([]collaboratorView, 0, len(collaborators))
+	for _, collaborator := range collaborators {
+		views = append(views, collaboratorView{Collaborator: collaborator, User: users[collaborator.UserID]})
+	}
+	return views
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwtauth"
+	"net/http"
+)
+
+type Permission string
+
+const (
+	PermTasksRead  Permission = jwtauth.ScopeTasksRead
+	PermTasksWrite Permission = jwtauth.ScopeTasksWrite
+	PermAdminTasks Permission = jwtauth.ScopeAdminTasks
+)
+
+var rolePermissions = map[string][]Permission{
+	jwtauth.RoleUser:  {PermTasksRead, PermTasksWrite},
+	jwtauth.RoleAdmin: {PermTasksRead, PermTasksWrite, PermAdminTasks},
+}
+
+// allowed reports whether any of the token's roles grants the permission.
+// A token that also lists scopes is limited to them.
+func allowed(claims *jwtauth.Claims, perm Permission) bool {
+	if len(claims.Scopes) > 0 && !claims.HasScope(string(perm)) {
+		return false
+	}
+
+	roles := claims.Roles
+	if len(roles) == 0 {
+		roles = []string{jwtauth.RoleUser}
+	}
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequirePermission guards a route; it runs after AuthMiddleware.
+func RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*jwtauth.Claims)
+		if !ok || !allowed(claims, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied: " + string(perm)})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// AuditLog records an action taken by an admin. The table is shared with
+// the user service, which records account administration.
+type AuditLog struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ActorID      uint      `gorm:"not null;index" json:"actor_id"`
+	Action       string    `gorm:"not null" json:"action"`
+	TargetUserID uint      `gorm:"index" json:"target_user_id"`
+	Details      string    `json:"details,omitempty"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the rights of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+var roles = []Role{RoleViewer, RoleEditor, RoleOwner}
+
+// RoleRankSQL is a SQL expression yielding the rank of collaborators.role,
+// so that queries can pick the strongest role the same way Allows does.
+// Unknown roles rank 0.
+var RoleRankSQL = func() string {
+	var b strings.Builder
+	b.WriteString("CASE collaborators.role")
+	for _, r := range roles {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", r, roleRank[r])
+	}
+	b.WriteString(" ELSE 0 END")
+	return b.String()
+}()
+
+// RoleOfRankSQL turns a rank computed with RoleRankSQL back into a role.
+func RoleOfRankSQL(expr string) string {
+	var b strings.Builder
+	b.WriteString("CASE " + expr)
+	for _, r := range roles {
+		fmt.Fprintf(&b, " WHEN %d THEN '%s'", roleRank[r], r)
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// Collaborator gives a user other than the task owner access to a task.
+type Collaborator struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TaskID    uint       `gorm:"not null;uniqueIndex:idx_collaborators_task_user,priority:1" json:"task_id"`
+	UserID    uint       `gorm:"not null;index;uniqueIndex:idx_collaborators_task_user,priority:2" json:"user_id"`
+	Role      Role       `gorm:"not null" json:"role"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+var priorityRank = map[Priority]int{
+	PriorityLow:    0,
+	PriorityNormal: 1,
+	PriorityHigh:   2,
+	PriorityUrgent: 3,
+}
+
+func (p Priority) Valid() bool {
+	_, ok := priorityRank[p]
+	return ok
+}
+
+// Rank orders priorities from low (0) to urgent (3). Unknown values rank
+// as normal, matching PriorityRankSQL.
+func (p Priority) Rank() int {
+	if rank, ok := priorityRank[p]; ok {
+		return rank
+	}
+	return priorityRank[PriorityNormal]
+}
+
+// PriorityRankSQL is a SQL expression yielding the rank of tasks.priority,
+// so that queries can order by priority the same way Rank does.
+var PriorityRankSQL = func() string {
+	var b strings.Builder
+	b.WriteString("CASE tasks.priority")
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent} {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", p, p.Rank())
+	}
+	b.WriteString(" ELSE 1 END")
+	return b.String()
+}()
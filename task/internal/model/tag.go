@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Tag is a user-defined label. Names are unique per user, ignoring case.
+type Tag struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Name      string     `gorm:"not null" json:"name"`
+	Color     string     `json:"color"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TaskTag is the join table between tasks and tags.
+type TaskTag struct {
+	TaskID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
@@ -9,13 +9,20 @@ import (
 )
 
 type Task struct {
-	ID          uint       `gorm:"primaryKey" json:"id"`
-	Title       string     `gorm:"not null" json:"title"`
-	Description string     `json:"description"`
-	Deadline    *time.Time `json:"deadline"`
-	UserID      uint       `gorm:"not null;index" json:"user_id"`
-	CreatedAt   *time.Time `gorm:"autoCreateTime" json:"created_at"`
-	IsReady     bool       `json:"is ready"`
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Title        string     `gorm:"not null" json:"title"`
+	Description  string     `json:"description"`
+	Deadline     *time.Time `gorm:"index:idx_tasks_user_deadline,priority:2" json:"deadline"`
+	UserID       uint       `gorm:"not null;index;index:idx_tasks_user_deadline,priority:1;index:idx_tasks_user_created,priority:1;index:idx_tasks_user_ready,priority:1" json:"user_id"`
+	CreatedAt    *time.Time `gorm:"autoCreateTime;index:idx_tasks_user_created,priority:2" json:"created_at"`
+	IsReady      bool       `gorm:"index:idx_tasks_user_ready,priority:2" json:"is_ready"`
+	Priority     Priority   `gorm:"not null;default:normal" json:"priority"`
+	RRule        string     `gorm:"column:rrule" json:"rrule,omitempty"`
+	SeriesID     *uint      `gorm:"uniqueIndex:idx_tasks_series_occurrence,priority:1" json:"series_id,omitempty"`
+	Occurrence   int        `gorm:"uniqueIndex:idx_tasks_series_occurrence,priority:2" json:"occurrence,omitempty"`
+	SeriesStart  *time.Time `json:"series_start,omitempty"`
+	ParentID     *uint      `gorm:"index" json:"parent_id,omitempty"`
+	AutoComplete bool       `json:"auto_complete"`
 }
 
 func ConnectDB() (*gorm.DB, error) {
@@ -36,7 +43,12 @@ func ConnectDB() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&Task{}); err != nil {
+	if err := db.AutoMigrate(&Task{}, &Collaborator{}, &Tag{}, &TaskTag{}, &AuditLog{}); err != nil {
+		return nil, err
+	}
+
+	// Tag names are unique per user regardless of case.
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags (user_id, LOWER(name))").Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,223 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=daily;interval=1", "FREQ=DAILY"},
+		{"FREQ=WEEKLY;BYDAY=FR,MO,we,MO", "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1,15;COUNT=3", "FREQ=MONTHLY;BYMONTHDAY=-1,15;COUNT=3"},
+		{"FREQ=YEARLY;INTERVAL=2;UNTIL=20300101T000000Z", "FREQ=YEARLY;INTERVAL=2;UNTIL=20300101T000000Z"},
+		{"FREQ=DAILY;UNTIL=2030-01-01T03:00:00+03:00", "FREQ=DAILY;UNTIL=20300101T000000Z"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"RRULE:",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20300101T000000Z",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;COUNT",
+		"FREQ=",
+	}
+	for _, in := range tests {
+		if r, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %v, want error", in, r)
+		}
+	}
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+}
+
+func TestIterate(t *testing.T) {
+	// Unbounded rules are compared on their first occurrences only; bounded
+	// ones (COUNT, UNTIL) must end exactly after want.
+	tests := []struct {
+		name    string
+		rule    string
+		start   time.Time
+		want    []time.Time
+		bounded bool
+	}{
+		{
+			name:  "daily with interval",
+			rule:  "FREQ=DAILY;INTERVAL=3",
+			start: date(2024, time.January, 30),
+			want:  []time.Time{date(2024, time.January, 30), date(2024, time.February, 2), date(2024, time.February, 5)},
+		},
+		{
+			name:  "weekly on the start weekday",
+			rule:  "FREQ=WEEKLY",
+			start: date(2024, time.May, 1),
+			want:  []time.Time{date(2024, time.May, 1), date(2024, time.May, 8), date(2024, time.May, 15)},
+		},
+		{
+			// 2024-05-01 is a Wednesday: Monday of that week is already past.
+			name:  "weekly by day",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			start: date(2024, time.May, 1),
+			want: []time.Time{
+				date(2024, time.May, 1), date(2024, time.May, 3),
+				date(2024, time.May, 6), date(2024, time.May, 8),
+			},
+		},
+		{
+			name:  "start off the BYDAY schedule",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO",
+			start: date(2024, time.May, 1),
+			want:  []time.Time{date(2024, time.May, 1), date(2024, time.May, 13), date(2024, time.May, 27)},
+		},
+		{
+			name:  "monthly skips short months",
+			rule:  "FREQ=MONTHLY",
+			start: date(2024, time.January, 31),
+			want:  []time.Time{date(2024, time.January, 31), date(2024, time.March, 31), date(2024, time.May, 31)},
+		},
+		{
+			name:  "monthly last day",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: date(2024, time.January, 31),
+			want:  []time.Time{date(2024, time.January, 31), date(2024, time.February, 29), date(2024, time.March, 31)},
+		},
+		{
+			name:  "yearly on leap day",
+			rule:  "FREQ=YEARLY",
+			start: date(2024, time.February, 29),
+			want:  []time.Time{date(2024, time.February, 29), date(2028, time.February, 29), date(2032, time.February, 29)},
+		},
+		{
+			name:    "count",
+			rule:    "FREQ=DAILY;COUNT=2",
+			start:   date(2024, time.May, 1),
+			want:    []time.Time{date(2024, time.May, 1), date(2024, time.May, 2)},
+			bounded: true,
+		},
+		{
+			name:    "until is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20240502T093000Z",
+			start:   date(2024, time.May, 1),
+			want:    []time.Time{date(2024, time.May, 1), date(2024, time.May, 2)},
+			bounded: true,
+		},
+		{
+			name:    "until before start",
+			rule:    "FREQ=DAILY;UNTIL=20240101T000000Z",
+			start:   date(2024, time.May, 1),
+			want:    nil,
+			bounded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []time.Time
+			r.Iterate(tt.start, func(n int, at time.Time) bool {
+				if n != len(got)+1 {
+					t.Fatalf("occurrence %d numbered %d", len(got)+1, n)
+				}
+				got = append(got, at)
+				return len(got) <= len(tt.want)
+			})
+			if !tt.bounded && len(got) > len(tt.want) {
+				got = got[:len(tt.want)]
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !got[i].Equal(want) {
+					t.Errorf("occurrence %d = %v, want %v", i+1, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestIterateKeepsLocalTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	r, _ := Parse("FREQ=DAILY")
+	start := time.Date(2024, time.March, 30, 9, 0, 0, 0, berlin)
+
+	// The clocks go forward on 31 March; the task still falls at 09:00.
+	at, ok := r.Occurrence(start, 3)
+	if !ok {
+		t.Fatal("no third occurrence")
+	}
+	if want := time.Date(2024, time.April, 1, 9, 0, 0, 0, berlin); !at.Equal(want) {
+		t.Errorf("third occurrence = %v, want %v", at, want)
+	}
+}
+
+func TestIterateTerminates(t *testing.T) {
+	// Every twelfth month from February is a February, which has no 31st.
+	r, err := Parse("FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	r.Iterate(date(2024, time.February, 10), func(int, time.Time) bool {
+		calls++
+		return true
+	})
+	if calls != 1 {
+		t.Errorf("got %d occurrences, want only the start", calls)
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	r, _ := Parse("FREQ=WEEKLY;COUNT=3")
+	start := date(2024, time.May, 1)
+
+	tests := []struct {
+		n      int
+		want   time.Time
+		wantOK bool
+	}{
+		{1, start, true},
+		{3, date(2024, time.May, 15), true},
+		{4, time.Time{}, false},
+		{0, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := r.Occurrence(start, tt.n)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("Occurrence(%d) = %v, %v; want %v, %v", tt.n, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
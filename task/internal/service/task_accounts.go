@@ -0,0 +1,38 @@
+package service
+
+import (
+	"task/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// DeleteUserData removes everything the user owns: their tasks (with all
+// subtasks), their tags, and their access to tasks shared with them.
+func (s *TaskService) DeleteUserData(userID uint) (int64, error) {
+	var deleted int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&model.Task{}).Where("user_id = ?", userID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		userTags := tx.Model(&model.Tag{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("task_id IN ? OR tag_id IN (?)", ids, userTags).Delete(&model.TaskTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Tag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("task_id IN ? OR user_id = ?", ids, userID).Delete(&model.Collaborator{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ?", userID).Delete(&model.Task{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return nil
+	})
+	return deleted, err
+}
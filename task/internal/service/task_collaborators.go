@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"task/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRole           = errors.New("invalid role: must be viewer, editor or owner")
+	ErrCollaboratorNotFound  = errors.New("collaborator not found")
+	ErrCollaboratorIsCreator = errors.New("task creator cannot be added as a collaborator")
+)
+
+func (s *TaskService) GetCollaborators(taskID, userID uint) ([]model.Collaborator, error) {
+	if _, _, err := s.loadTask(taskID, userID, model.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	collaborators := make([]model.Collaborator, 0)
+	if err := s.db.Where("task_id = ?", taskID).Order("id").Find(&collaborators).Error; err != nil {
+		return nil, err
+	}
+	return collaborators, nil
+}
+
+// ShareTask grants collaboratorID the given role on a task, or changes the
+// role if the user is already a collaborator. Only owners may share, and
+// only the creator may grant, change or take away the owner role.
+func (s *TaskService) ShareTask(taskID, userID, collaboratorID uint, role model.Role) (*model.Collaborator, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	task, _, err := s.loadTask(taskID, userID, model.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if task.UserID == collaboratorID {
+		return nil, ErrCollaboratorIsCreator
+	}
+	creator := task.UserID == userID
+	if role == model.RoleOwner && !creator {
+		return nil, ErrCreatorOnly
+	}
+
+	var collaborator model.Collaborator
+	err = s.db.Where("task_id = ? AND user_id = ?", taskID, collaboratorID).First(&collaborator).Error
+	if err == nil && collaborator.Role == model.RoleOwner && !creator {
+		return nil, ErrCreatorOnly
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		collaborator = model.Collaborator{TaskID: taskID, UserID: collaboratorID, Role: role}
+		if err := s.db.Create(&collaborator).Error; err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		collaborator.Role = role
+		if err := s.db.Save(&collaborator).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &collaborator, nil
+}
+
+// RevokeAccess removes a collaborator. Owners may remove anyone but other
+// owners, whom only the creator may remove; every collaborator may remove
+// themselves.
+func (s *TaskService) RevokeAccess(taskID, userID, collaboratorID uint) error {
+	required := model.RoleOwner
+	if userID == collaboratorID {
+		required = model.RoleViewer
+	}
+	task, _, err := s.loadTask(taskID, userID, required)
+	if err != nil {
+		return err
+	}
+
+	if task.UserID != userID && userID != collaboratorID {
+		var target model.Collaborator
+		err := s.db.Where("task_id = ? AND user_id = ?", taskID, collaboratorID).First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCollaboratorNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if target.Role == model.RoleOwner {
+			return ErrCreatorOnly
+		}
+	}
+
+	result := s.db.Where("task_id = ? AND user_id = ?", taskID, collaboratorID).Delete(&model.Collaborator{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCollaboratorNotFound
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"task/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// TaskFilter describes a GET /tasks query. Zero values mean "no filter".
+type TaskFilter struct {
+	IsReady       *bool
+	DueBefore     *time.Time
+	DueAfter      *time.Time
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	Query         string
+	Tags          []string
+	TagMode       TagMode
+	Sort          string
+	Cursor        string
+	Limit         int
+}
+
+// UserRef is how a task list shows a user. The data comes from the user
+// service.
+type UserRef struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// TaskWithRole is a task as seen by a particular user.
+type TaskWithRole struct {
+	model.Task
+	Role  model.Role  `json:"role"`
+	Tags  []model.Tag `gorm:"-" json:"tags"`
+	Owner *UserRef    `gorm:"-" json:"owner,omitempty"`
+}
+
+type TaskPage struct {
+	Tasks      []TaskWithRole `json:"tasks"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindTime
+	kindInt
+)
+
+type sortColumn struct {
+	field    string
+	expr     string
+	desc     bool
+	nullable bool
+	kind     valueKind
+}
+
+// sortKey is an ordered list of columns; ties are broken by tasks.id.
+type sortKey struct {
+	columns []sortColumn
+	idDesc  bool
+}
+
+var (
+	createdAtColumn = sortColumn{field: "created_at", expr: "tasks.created_at", kind: kindTime, nullable: true}
+	deadlineColumn  = sortColumn{field: "deadline", expr: "tasks.deadline", kind: kindTime, nullable: true}
+	titleColumn     = sortColumn{field: "title", expr: "tasks.title"}
+	priorityColumn  = sortColumn{field: "priority", expr: model.PriorityRankSQL, kind: kindInt}
+)
+
+func single(col sortColumn, desc bool) sortKey {
+	col.desc = desc
+	return sortKey{columns: []sortColumn{col}, idDesc: desc}
+}
+
+func descending(col sortColumn) sortColumn {
+	col.desc = true
+	return col
+}
+
+// Supported sort orders. Single-column sorts break ties by id in the same
+// direction. "smart" puts the most urgent work first: highest priority,
+// then nearest deadline, then oldest.
+var sortKeys = map[string]sortKey{
+	"created_at":  single(createdAtColumn, false),
+	"-created_at": single(createdAtColumn, true),
+	"deadline":    single(deadlineColumn, false),
+	"-deadline":   single(deadlineColumn, true),
+	"title":       single(titleColumn, false),
+	"-title":      single(titleColumn, true),
+	"priority":    single(priorityColumn, false),
+	"-priority":   single(priorityColumn, true),
+	"smart": {columns: []sortColumn{
+		descending(priorityColumn),
+		deadlineColumn,
+		createdAtColumn,
+	}},
+}
+
+// cursor is the decoded form of the opaque next_cursor token: the sort
+// it was issued for plus the sort values and id of the last returned row.
+type cursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"`
+	ID     uint      `json:"id"`
+}
+
+func encodeCursor(cur cursor) string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur cursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
+
+// sharedAccessSQL selects the tasks shared with one user, directly or
+// through an ancestor, with the rank of the user's best role on each. It
+// resolves access the same way roleOf does.
+var sharedAccessSQL = fmt.Sprintf(`WITH RECURSIVE shared (task_id, role_rank, depth) AS (
+	SELECT collaborators.task_id, %s, 0 FROM collaborators WHERE collaborators.user_id = ?
+	UNION ALL
+	SELECT tasks.id, shared.role_rank, shared.depth + 1
+	FROM tasks JOIN shared ON tasks.parent_id = shared.task_id
+	WHERE shared.depth < %d
+) SELECT task_id, MAX(role_rank) AS role_rank FROM shared GROUP BY task_id`, model.RoleRankSQL, MaxTaskDepth)
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListTasks returns one page of the tasks the user owns or collaborates on
+// that match filter, each with the user's role on it. Subtasks of shared
+// tasks are included.
+func (s *TaskService) ListTasks(userID uint, filter TaskFilter) (*TaskPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = "created_at"
+	}
+	switch filter.TagMode {
+	case "":
+		filter.TagMode = TagModeAny
+	case TagModeAny, TagModeAll:
+	default:
+		return nil, ErrInvalidTagMode
+	}
+	key, ok := sortKeys[filter.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	query := s.db.Model(&model.Task{}).
+		Select("tasks.*, CASE WHEN tasks.user_id = ? THEN ? ELSE "+model.RoleOfRankSQL("access.role_rank")+" END AS role",
+			userID, model.RoleOwner).
+		Joins("LEFT JOIN ("+sharedAccessSQL+") AS access ON access.task_id = tasks.id", userID).
+		Where("tasks.user_id = ? OR access.role_rank > 0", userID)
+	query = applyFilter(query, filter)
+	query = tagFilter(query, userID, filter.Tags, filter.TagMode)
+
+	if filter.Cursor != "" {
+		cur, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Sort != filter.Sort {
+			return nil, ErrInvalidCursor
+		}
+		query, err = applyCursor(query, key, cur)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, col := range key.columns {
+		order := col.expr + " " + direction(col.desc)
+		if col.nullable {
+			order += " NULLS LAST"
+		}
+		query = query.Order(order)
+	}
+
+	tasks := make([]TaskWithRole, 0, limit+1)
+	err := query.
+		Order("tasks.id " + direction(key.idDesc)).
+		Limit(limit + 1).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		last := page.Tasks[limit-1]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:   filter.Sort,
+			Values: sortValues(key, &last.Task),
+			ID:     last.ID,
+		})
+	}
+
+	ids := make([]uint, len(page.Tasks))
+	for i := range page.Tasks {
+		ids[i] = page.Tasks[i].ID
+	}
+	tags, err := tagsByTask(s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Tasks {
+		page.Tasks[i].Tags = tags[page.Tasks[i].ID]
+	}
+	return page, nil
+}
+
+func applyFilter(query *gorm.DB, filter TaskFilter) *gorm.DB {
+	if filter.IsReady != nil {
+		query = query.Where("tasks.is_ready = ?", *filter.IsReady)
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("tasks.deadline < ?", *filter.DueBefore)
+	}
+	if filter.DueAfter != nil {
+		query = query.Where("tasks.deadline > ?", *filter.DueAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("tasks.created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("tasks.created_at > ?", *filter.CreatedAfter)
+	}
+	if filter.Query != "" {
+		query = query.Where("tasks.title ILIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+	return query
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func comparison(desc bool) string {
+	if desc {
+		return "<"
+	}
+	return ">"
+}
+
+// applyCursor restricts the query to rows strictly after the cursor
+// position in keyset order. NULL sort values are ordered last in both
+// directions, so nothing non-NULL comes after a NULL.
+func applyCursor(query *gorm.DB, key sortKey, cur *cursor) (*gorm.DB, error) {
+	if len(cur.Values) != len(key.columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(key.columns))
+	for i, col := range key.columns {
+		raw := cur.Values[i]
+		if raw == nil {
+			if !col.nullable {
+				return nil, ErrInvalidCursor
+			}
+			continue
+		}
+		v, err := parseSortValue(col, *raw)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v
+	}
+
+	// Row comes after the cursor if, for some i, columns before i are equal
+	// and column i is strictly after; or all columns are equal and id is.
+	var (
+		branches []string
+		args     []interface{}
+		equal    []string
+		eqArgs   []interface{}
+	)
+	for i, col := range key.columns {
+		if values[i] == nil {
+			equal = append(equal, col.expr+" IS NULL")
+			continue
+		}
+
+		after := fmt.Sprintf("%s %s ?", col.expr, comparison(col.desc))
+		if col.nullable {
+			after = fmt.Sprintf("(%s OR %s IS NULL)", after, col.expr)
+		}
+		branches = append(branches, strings.Join(append(append([]string{}, equal...), after), " AND "))
+		args = append(append(args, eqArgs...), values[i])
+
+		equal = append(equal, col.expr+" = ?")
+		eqArgs = append(eqArgs, values[i])
+	}
+	idAfter := fmt.Sprintf("tasks.id %s ?", comparison(key.idDesc))
+	branches = append(branches, strings.Join(append(equal, idAfter), " AND "))
+	args = append(append(args, eqArgs...), cur.ID)
+
+	cond := "((" + strings.Join(branches, ") OR (") + "))"
+	return query.Where(cond, args...), nil
+}
+
+func parseSortValue(col sortColumn, raw string) (interface{}, error) {
+	switch col.kind {
+	case kindTime:
+		return time.Parse(time.RFC3339Nano, raw)
+	case kindInt:
+		return strconv.Atoi(raw)
+	}
+	return raw, nil
+}
+
+func sortValues(key sortKey, task *model.Task) []*string {
+	values := make([]*string, len(key.columns))
+	for i, col := range key.columns {
+		values[i] = sortValue(col, task)
+	}
+	return values
+}
+
+func sortValue(col sortColumn, task *model.Task) *string {
+	var t *time.Time
+	switch col.field {
+	case "title":
+		return &task.Title
+	case "priority":
+		v := strconv.Itoa(task.Priority.Rank())
+		return &v
+	case "created_at":
+		t = task.CreatedAt
+	case "deadline":
+		t = task.Deadline
+	}
+	if t == nil {
+		return nil
+	}
+	v := t.UTC().Format(time.RFC3339Nano)
+	return &v
+}
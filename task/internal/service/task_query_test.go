@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"task/internal/model"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB builds SQL without a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// sqlRecorder collects the statements a dry-run DB would have executed.
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+func recordSQL(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	db := dryRunDB(t)
+	rec := &sqlRecorder{Interface: db.Logger}
+	db.Logger = rec
+	return db, rec
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "created_at", Values: []*string{strPtr("2024-05-01T10:00:00Z")}, ID: 7},
+		{Sort: "-deadline", Values: []*string{nil}, ID: 1},
+		{Sort: "smart", Values: []*string{strPtr("3"), nil, strPtr("2024-05-01T10:00:00.5Z")}, ID: 42},
+		{Sort: "title", Values: []*string{strPtr("100% \"done\" / ünïcode")}, ID: 9},
+	}
+	for _, want := range tests {
+		token := encodeCursor(want)
+		if strings.ContainsAny(token, "+/=") {
+			t.Errorf("token %q is not URL safe", token)
+		}
+		got, err := decodeCursor(token)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", token, err)
+		}
+		if got.Sort != want.Sort || got.ID != want.ID || len(got.Values) != len(want.Values) {
+			t.Fatalf("decodeCursor(encodeCursor(%+v)) = %+v", want, got)
+		}
+		for i := range want.Values {
+			if (got.Values[i] == nil) != (want.Values[i] == nil) ||
+				(want.Values[i] != nil && *got.Values[i] != *want.Values[i]) {
+				t.Errorf("value %d: got %v, want %v", i, got.Values[i], want.Values[i])
+			}
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []string{
+		"not base64!",
+		"bm90IGpzb24",             // "not json"
+		"eyJzIjoxfQ",              // {"s":1}
+		"eyJpZCI6Ii0xIn0",         // {"id":"-1"}
+		"eyJzIjoieCIsImlkIjotMX0", // {"s":"x","id":-1}
+	}
+	for _, token := range tests {
+		if _, err := decodeCursor(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", token, err)
+		}
+	}
+}
+
+func TestSortValues(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 500, time.FixedZone("MSK", 3*3600))
+	task := &model.Task{ID: 5, Title: "write tests", Priority: model.PriorityHigh, CreatedAt: &created}
+
+	got := sortValues(sortKeys["smart"], task)
+	want := []*string{strPtr("2"), nil, strPtr("2024-05-01T09:00:00.0000005Z")}
+	if len(got) != len(want) {
+		t.Fatalf("got %d values, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if (got[i] == nil) != (want[i] == nil) || (want[i] != nil && *got[i] != *want[i]) {
+			t.Errorf("value %d: got %v, want %v", i, deref(got[i]), deref(want[i]))
+		}
+	}
+
+	if v := sortValues(sortKeys["-title"], task); len(v) != 1 || *v[0] != "write tests" {
+		t.Errorf("title sort values = %v", v)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestApplyCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		values  []*string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "ascending nullable",
+			sort:   "created_at",
+			values: []*string{strPtr("2024-05-01T10:00:00Z")},
+			want: `(((tasks.created_at > '2024-05-01 10:00:00' OR tasks.created_at IS NULL)) OR ` +
+				`(tasks.created_at = '2024-05-01 10:00:00' AND tasks.id > 7))`,
+		},
+		{
+			name:   "descending",
+			sort:   "-title",
+			values: []*string{strPtr("b")},
+			want:   `((tasks.title < 'b') OR (tasks.title = 'b' AND tasks.id < 7))`,
+		},
+		{
+			name:   "null position",
+			sort:   "deadline",
+			values: []*string{nil},
+			want:   `((tasks.deadline IS NULL AND tasks.id > 7))`,
+		},
+		{
+			name:    "wrong number of values",
+			sort:    "smart",
+			values:  []*string{strPtr("1")},
+			wantErr: true,
+		},
+		{
+			name:    "null in a non-nullable column",
+			sort:    "title",
+			values:  []*string{nil},
+			wantErr: true,
+		},
+		{
+			name:    "malformed time",
+			sort:    "deadline",
+			values:  []*string{strPtr("yesterday")},
+			wantErr: true,
+		},
+		{
+			name:    "malformed priority",
+			sort:    "priority",
+			values:  []*string{strPtr("high")},
+			wantErr: true,
+		},
+	}
+
+	db := dryRunDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var applyErr error
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				query, err := applyCursor(tx.Model(&model.Task{}), sortKeys[tt.sort], &cursor{Sort: tt.sort, Values: tt.values, ID: 7})
+				if err != nil {
+					applyErr = err
+					return tx
+				}
+				return query.Find(&[]model.Task{})
+			})
+			if tt.wantErr {
+				if !errors.Is(applyErr, ErrInvalidCursor) {
+					t.Fatalf("error = %v, want ErrInvalidCursor", applyErr)
+				}
+				return
+			}
+			if applyErr != nil {
+				t.Fatal(applyErr)
+			}
+			if !strings.Contains(sql, tt.want) {
+				t.Errorf("SQL %s\ndoes not contain %s", sql, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCursorSmart(t *testing.T) {
+	db := dryRunDB(t)
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query, err := applyCursor(tx.Model(&model.Task{}), sortKeys["smart"], &cursor{
+			Sort:   "smart",
+			Values: []*string{strPtr("2"), nil, strPtr("2024-05-01T10:00:00Z")},
+			ID:     3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return query.Find(&[]model.Task{})
+	})
+
+	// Priority is descending; the NULL deadline only allows equal deadlines
+	// to continue to created_at and id.
+	rank := model.PriorityRankSQL
+	for _, want := range []string{
+		"(" + rank + " < 2)",
+		rank + " = 2 AND tasks.deadline IS NULL AND (tasks.created_at > '2024-05-01 10:00:00' OR tasks.created_at IS NULL)",
+		rank + " = 2 AND tasks.deadline IS NULL AND tasks.created_at = '2024-05-01 10:00:00' AND tasks.id > 3",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL %s\ndoes not contain %s", sql, want)
+		}
+	}
+}
+
+func TestListTasksIncludesSharedSubtasks(t *testing.T) {
+	db, rec := recordSQL(t)
+	if _, err := NewTaskService(db).ListTasks(7, TaskFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.statements) == 0 {
+		t.Fatal("no query")
+	}
+
+	// Access granted on a task reaches its subtasks, as in roleOf.
+	sql := rec.statements[0]
+	for _, want := range []string{
+		"WHERE collaborators.user_id = 7",
+		"FROM tasks JOIN shared ON tasks.parent_id = shared.task_id",
+		"MAX(role_rank) AS role_rank FROM shared GROUP BY task_id",
+		"tasks.user_id = 7 OR access.role_rank > 0",
+		"CASE WHEN tasks.user_id = 7 THEN 'owner' ELSE " + model.RoleOfRankSQL("access.role_rank"),
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL %s\ndoes not contain %s", sql, want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"plain":      "plain",
+		"100%":       `100\%`,
+		"snake_case": `snake\_case`,
+		`C:\tmp`:     `C:\\tmp`,
+		`\%_`:        `\\\%\_`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
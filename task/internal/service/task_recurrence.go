@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"task/internal/model"
+	"task/internal/recurrence"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const MaxPreviewOccurrences = 100
+
+var (
+	ErrInvalidRecurrence       = errors.New("invalid recurrence rule")
+	ErrRecurrenceNeedsDeadline = errors.New("recurring task requires a deadline")
+	ErrTaskNotRecurring        = errors.New("task is not recurring")
+)
+
+// setRecurrence applies rrule to task. A changed rule, or a deadline moved
+// off the series schedule, restarts the series from the task's current
+// deadline; an empty rule stops the series.
+func setRecurrence(task *model.Task, rrule string) error {
+	if rrule == "" {
+		task.RRule = ""
+		return nil
+	}
+
+	rule, err := recurrence.Parse(rrule)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+	}
+	if task.Deadline == nil {
+		return ErrRecurrenceNeedsDeadline
+	}
+
+	canonical := rule.String()
+	if canonical == task.RRule && task.SeriesStart != nil {
+		due, ok := rule.Occurrence(*task.SeriesStart, task.Occurrence)
+		if ok && due.Equal(*task.Deadline) {
+			return nil
+		}
+	}
+
+	start := *task.Deadline
+	task.RRule = canonical
+	task.SeriesStart = &start
+	task.Occurrence = 1
+	task.SeriesID = nil
+	if task.ID != 0 {
+		id := task.ID
+		task.SeriesID = &id
+	}
+	return nil
+}
+
+// spawnNextOccurrence creates the occurrence that follows a just completed
+// recurring task, skipping occurrences that are already past. The next
+// occurrence stays under the same parent and keeps the tags and sharing.
+func spawnNextOccurrence(tx *gorm.DB, task *model.Task) (*model.Task, error) {
+	if task.RRule == "" || task.SeriesID == nil || task.SeriesStart == nil {
+		return nil, nil
+	}
+
+	var later int64
+	err := tx.Model(&model.Task{}).
+		Where("series_id = ? AND occurrence > ?", *task.SeriesID, task.Occurrence).
+		Count(&later).Error
+	if err != nil {
+		return nil, err
+	}
+	if later > 0 {
+		return nil, nil
+	}
+
+	rule, err := recurrence.Parse(task.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var next *model.Task
+	rule.Iterate(*task.SeriesStart, func(n int, t time.Time) bool {
+		if n <= task.Occurrence || !t.After(now) {
+			return true
+		}
+		deadline := t
+		next = &model.Task{
+			Title:        task.Title,
+			Description:  task.Description,
+			Deadline:     &deadline,
+			UserID:       task.UserID,
+			Priority:     task.Priority,
+			RRule:        task.RRule,
+			SeriesID:     task.SeriesID,
+			Occurrence:   n,
+			SeriesStart:  task.SeriesStart,
+			ParentID:     task.ParentID,
+			AutoComplete: task.AutoComplete,
+		}
+		return false
+	})
+	if next == nil {
+		return nil, nil
+	}
+
+	if err := tx.Create(next).Error; err != nil {
+		return nil, err
+	}
+
+	var tags []model.TaskTag
+	if err := tx.Where("task_id = ?", task.ID).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if err := tx.Create(&model.TaskTag{TaskID: next.ID, TagID: tag.TagID}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// The next occurrence is shared with the same people as this one.
+	var collaborators []model.Collaborator
+	if err := tx.Where("task_id = ?", task.ID).Find(&collaborators).Error; err != nil {
+		return nil, err
+	}
+	for _, collaborator := range collaborators {
+		copied := model.Collaborator{TaskID: next.ID, UserID: collaborator.UserID, Role: collaborator.Role}
+		if err := tx.Create(&copied).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if next.ParentID != nil {
+		if err := syncParent(tx, *next.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// UpcomingOccurrences previews the deadlines of the occurrences that follow
+// the given task in its series.
+func (s *TaskService) UpcomingOccurrences(taskID, userID uint, count int) ([]time.Time, error) {
+	task, _, err := s.GetTask(taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if task.RRule == "" || task.SeriesStart == nil {
+		return nil, ErrTaskNotRecurring
+	}
+
+	rule, err := recurrence.Parse(task.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	if count <= 0 || count > MaxPreviewOccurrences {
+		count = MaxPreviewOccurrences
+	}
+
+	occurrences := make([]time.Time, 0, count)
+	rule.Iterate(*task.SeriesStart, func(n int, t time.Time) bool {
+		if n > task.Occurrence {
+			occurrences = append(occurrences, t)
+		}
+		return len(occurrences) < count
+	})
+	return occurrences, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"task/internal/model"
+	"testing"
+	"time"
+)
+
+func TestSetRecurrence(t *testing.T) {
+	start := time.Date(2030, time.May, 1, 9, 0, 0, 0, time.UTC)
+	third := start.AddDate(0, 0, 14)
+	moved := third.Add(2 * time.Hour)
+	seriesID := uint(3)
+
+	// occurrence is the third task of a weekly series started by task 3.
+	occurrence := func(deadline time.Time) *model.Task {
+		return &model.Task{
+			ID:          10,
+			Deadline:    &deadline,
+			RRule:       "FREQ=WEEKLY",
+			SeriesID:    &seriesID,
+			Occurrence:  3,
+			SeriesStart: &start,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		task       *model.Task
+		rrule      string
+		wantErr    error
+		wantRule   string
+		wantStart  *time.Time
+		wantSeries uint
+		wantNumber int
+	}{
+		{
+			name:       "same rule on schedule",
+			task:       occurrence(third),
+			rrule:      "RRULE:freq=weekly",
+			wantRule:   "FREQ=WEEKLY",
+			wantStart:  &start,
+			wantSeries: 3,
+			wantNumber: 3,
+		},
+		{
+			name:       "deadline moved off schedule",
+			task:       occurrence(moved),
+			rrule:      "FREQ=WEEKLY",
+			wantRule:   "FREQ=WEEKLY",
+			wantStart:  &moved,
+			wantSeries: 10,
+			wantNumber: 1,
+		},
+		{
+			name:       "rule changed",
+			task:       occurrence(third),
+			rrule:      "FREQ=DAILY",
+			wantRule:   "FREQ=DAILY",
+			wantStart:  &third,
+			wantSeries: 10,
+			wantNumber: 1,
+		},
+		{
+			name:       "new task",
+			task:       &model.Task{Deadline: &start},
+			rrule:      "FREQ=MONTHLY;BYMONTHDAY=1",
+			wantRule:   "FREQ=MONTHLY;BYMONTHDAY=1",
+			wantStart:  &start,
+			wantNumber: 1,
+		},
+		{
+			name:       "stopped",
+			task:       occurrence(third),
+			rrule:      "",
+			wantStart:  &start,
+			wantSeries: 3,
+			wantNumber: 3,
+		},
+		{
+			name:    "invalid rule",
+			task:    occurrence(third),
+			rrule:   "FREQ=HOURLY",
+			wantErr: ErrInvalidRecurrence,
+		},
+		{
+			name:    "no deadline",
+			task:    &model.Task{},
+			rrule:   "FREQ=DAILY",
+			wantErr: ErrRecurrenceNeedsDeadline,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setRecurrence(tt.task, tt.rrule)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			task := tt.task
+			if task.RRule != tt.wantRule {
+				t.Errorf("RRule = %q, want %q", task.RRule, tt.wantRule)
+			}
+			if task.SeriesStart == nil || !task.SeriesStart.Equal(*tt.wantStart) {
+				t.Errorf("SeriesStart = %v, want %v", task.SeriesStart, *tt.wantStart)
+			}
+			var series uint
+			if task.SeriesID != nil {
+				series = *task.SeriesID
+			}
+			if series != tt.wantSeries || task.Occurrence != tt.wantNumber {
+				t.Errorf("series %d occurrence %d, want %d and %d", series, task.Occurrence, tt.wantSeries, tt.wantNumber)
+			}
+		})
+	}
+}
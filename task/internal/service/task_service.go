@@ -7,6 +7,17 @@ import (
 	"time"
 )
 
+var (
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrTaskForbidden   = errors.New("not enough rights on task")
+	ErrEmptyTitle      = errors.New("empty title")
+	ErrDeadlineInPast  = errors.New("deadline cannot be in the past")
+	ErrInvalidPriority = errors.New("invalid priority: must be low, normal, high or urgent")
+	// ErrCreatorOnly guards what a collaborator with the owner role still
+	// may not do: delete the task or make others owners.
+	ErrCreatorOnly = errors.New("only the task creator can do this")
+)
+
 type TaskService struct {
 	db *gorm.DB
 }
@@ -15,66 +26,338 @@ func NewTaskService(db *gorm.DB) *TaskService {
 	return &TaskService{db: db}
 }
 
-func (s *TaskService) GetTaskByUser(userId uint) ([]model.Task, error) {
-	var tasks []model.Task
-	if err := s.db.Where("user_id = ?", userId).Find(&tasks).Error; err != nil {
+// TaskPatch holds a partial update: nil fields are left untouched.
+type TaskPatch struct {
+	Title        *string
+	Description  *string
+	Deadline     *time.Time
+	IsReady      *bool
+	RRule        *string
+	Priority     *model.Priority
+	ParentID     *uint // 0 moves the task to the top level
+	AutoComplete *bool
+}
+
+// setReady changes the task state. Completing an occurrence of a recurring
+// task creates and returns the next one; any change is propagated to an
+// auto-completing parent.
+func setReady(tx *gorm.DB, task *model.Task, isReady bool) (*model.Task, error) {
+	changed := task.IsReady != isReady
+	task.IsReady = isReady
+
+	if err := tx.Save(task).Error; err != nil {
 		return nil, err
 	}
-	return tasks, nil
+	if !changed {
+		return nil, nil
+	}
+
+	var next *model.Task
+	if isReady {
+		var err error
+		if next, err = spawnNextOccurrence(tx, task); err != nil {
+			return nil, err
+		}
+	}
+	if task.ParentID != nil {
+		if err := syncParent(tx, *task.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// normalizePriority defaults an empty priority to normal and rejects unknown values.
+func normalizePriority(p model.Priority) (model.Priority, error) {
+	if p == "" {
+		return model.PriorityNormal, nil
+	}
+	if !p.Valid() {
+		return "", ErrInvalidPriority
+	}
+	return p, nil
+}
+
+// GetTask loads a task visible to userID together with the user's role on it.
+func (s *TaskService) GetTask(taskID, userID uint) (*model.Task, model.Role, error) {
+	return s.loadTask(taskID, userID, model.RoleViewer)
+}
+
+// loadTask loads a task and checks that userID has at least the required role.
+// The task owner always has RoleOwner; other users need a collaborator entry.
+func (s *TaskService) loadTask(taskID, userID uint, required model.Role) (*model.Task, model.Role, error) {
+	var task model.Task
+	if err := s.db.First(&task, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrTaskNotFound
+		}
+		return nil, "", err
+	}
+
+	role, err := s.roleOf(&task, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" || !role.Allows(required) {
+		return nil, "", ErrTaskForbidden
+	}
+	return &task, role, nil
+}
+
+// roleOf resolves the user's role on a task. Access granted on a task also
+// covers all of its subtasks, so collaborators of ancestors are considered.
+func (s *TaskService) roleOf(task *model.Task, userID uint) (model.Role, error) {
+	if task.UserID == userID {
+		return model.RoleOwner, nil
+	}
+
+	chain, err := ancestors(s.db, task)
+	if err != nil {
+		return "", err
+	}
+	ids := append([]uint{task.ID}, taskIDs(chain)...)
+
+	var collaborators []model.Collaborator
+	if err := s.db.Where("task_id IN ? AND user_id = ?", ids, userID).Find(&collaborators).Error; err != nil {
+		return "", err
+	}
+
+	var role model.Role
+	for _, collaborator := range collaborators {
+		if role == "" || collaborator.Role.Allows(role) {
+			role = collaborator.Role
+		}
+	}
+	return role, nil
 }
 
 func (s *TaskService) CreateTask(task *model.Task) error {
+	rrule := task.RRule
 	if task.Title == "" {
-		return errors.New("empty title")
+		return ErrEmptyTitle
 	}
 
 	if task.Deadline != nil && time.Now().After(*task.Deadline) {
-		return errors.New("deadline cannot be in the past")
+		return ErrDeadlineInPast
+	}
+
+	priority, err := normalizePriority(task.Priority)
+	if err != nil {
+		return err
 	}
+	task.Priority = priority
 
 	task.IsReady = false
-	return s.db.Create(task).Error
+	task.RRule, task.SeriesID, task.Occurrence, task.SeriesStart = "", nil, 0, nil
+	if err := setRecurrence(task, rrule); err != nil {
+		return err
+	}
+
+	// A subtask belongs to the owner of its tree, whoever creates it.
+	if task.ParentID != nil {
+		parent, _, err := s.loadTask(*task.ParentID, task.UserID, model.RoleEditor)
+		if err != nil {
+			if errors.Is(err, ErrTaskNotFound) {
+				return ErrParentNotFound
+			}
+			return err
+		}
+		task.UserID = parent.UserID
+		if err := checkParent(s.db, task, parent); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(task).Error; err != nil {
+			return err
+		}
+		if task.RRule != "" {
+			id := task.ID
+			task.SeriesID = &id
+			if err := tx.Model(task).Update("series_id", id).Error; err != nil {
+				return err
+			}
+		}
+		if task.ParentID != nil {
+			return syncParent(tx, *task.ParentID)
+		}
+		return nil
+	})
 }
 
+// DeleteTask removes a task with all its subtasks. Only its creator may.
 func (s *TaskService) DeleteTask(taskID, userID uint) error {
-	result := s.db.Where("id = ? AND user_id = ?", taskID, userID).Delete(&model.Task{})
-	if result.Error != nil {
-		return result.Error
+	task, _, err := s.loadTask(taskID, userID, model.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if task.UserID != userID {
+		return ErrCreatorOnly
+	}
+
+	levels, err := descendants(s.db, []uint{task.ID})
+	if err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return errors.New("task not found or does not belong to user")
+	ids := []uint{task.ID}
+	for _, level := range levels {
+		ids = append(ids, taskIDs(level)...)
 	}
-	return nil
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id IN ?", ids).Delete(&model.Collaborator{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("task_id IN ?", ids).Delete(&model.TaskTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.Task{}, ids).Error; err != nil {
+			return err
+		}
+		if task.ParentID != nil {
+			return syncParent(tx, *task.ParentID)
+		}
+		return nil
+	})
 }
 
-func (s *TaskService) UpdateTask(taskID, userID uint, newTitle, newDescription string, newDeadline *time.Time) error {
-	var task model.Task
+func (s *TaskService) UpdateTask(taskID, userID uint, patch TaskPatch) (*model.Task, error) {
+	task, _, err := s.loadTask(taskID, userID, model.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
-		return err
+	if patch.Title != nil {
+		if *patch.Title == "" {
+			return nil, ErrEmptyTitle
+		}
+		task.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.Deadline != nil {
+		if time.Now().After(*patch.Deadline) {
+			return nil, ErrDeadlineInPast
+		}
+		task.Deadline = patch.Deadline
+	}
+	if patch.Priority != nil {
+		priority, err := normalizePriority(*patch.Priority)
+		if err != nil {
+			return nil, err
+		}
+		task.Priority = priority
+	}
+	if patch.RRule != nil || patch.Deadline != nil {
+		rrule := task.RRule
+		if patch.RRule != nil {
+			rrule = *patch.RRule
+		}
+		if err := setRecurrence(task, rrule); err != nil {
+			return nil, err
+		}
+	}
+	if patch.AutoComplete != nil {
+		task.AutoComplete = *patch.AutoComplete
 	}
 
-	if newTitle != "" {
-		task.Title = newTitle
+	oldParentID := task.ParentID
+	if patch.ParentID != nil {
+		if err := s.setParent(task, *patch.ParentID, userID); err != nil {
+			return nil, err
+		}
 	}
-	if newDescription != "" {
-		task.Description = newDescription
+
+	isReady := task.IsReady
+	if patch.IsReady != nil {
+		isReady = *patch.IsReady
 	}
-	if newDeadline != nil && time.Now().After(*newDeadline) {
-		task.Deadline = newDeadline
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := setReady(tx, task, isReady); err != nil {
+			return err
+		}
+		return syncTree(tx, task, oldParentID)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return task, nil
+}
 
-	return s.db.Save(&task).Error
+// TaskFields is the full editable state of a task, as sent with PUT.
+type TaskFields struct {
+	Title        string
+	Description  string
+	Deadline     *time.Time
+	IsReady      bool
+	RRule        string
+	Priority     model.Priority
+	ParentID     uint // 0 means a top-level task
+	AutoComplete bool
 }
 
-func (s *TaskService) UpdateStateTask(taskID, userID uint, isReady bool) error {
-	var task model.Task
+// ReplaceTask overwrites all editable fields of a task, as PUT does.
+func (s *TaskService) ReplaceTask(taskID, userID uint, fields TaskFields) (*model.Task, error) {
+	task, _, err := s.loadTask(taskID, userID, model.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
-		return err
+	if fields.Title == "" {
+		return nil, ErrEmptyTitle
+	}
+	if fields.Deadline != nil && time.Now().After(*fields.Deadline) {
+		return nil, ErrDeadlineInPast
+	}
+	priority, err := normalizePriority(fields.Priority)
+	if err != nil {
+		return nil, err
 	}
 
-	task.IsReady = isReady
+	task.Title = fields.Title
+	task.Description = fields.Description
+	task.Deadline = fields.Deadline
+	task.Priority = priority
+	task.AutoComplete = fields.AutoComplete
+	if err := setRecurrence(task, fields.RRule); err != nil {
+		return nil, err
+	}
+
+	oldParentID := task.ParentID
+	if err := s.setParent(task, fields.ParentID, userID); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := setReady(tx, task, fields.IsReady); err != nil {
+			return err
+		}
+		return syncTree(tx, task, oldParentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// UpdateStateTask sets the task state and returns the next occurrence
+// if completing a recurring task produced one.
+func (s *TaskService) UpdateStateTask(taskID, userID uint, isReady bool) (*model.Task, *model.Task, error) {
+	task, _, err := s.loadTask(taskID, userID, model.RoleEditor)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return s.db.Save(&task).Error
+	var next *model.Task
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		next, err = setReady(tx, task, isReady)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return task, next, nil
 }
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"task/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// MaxTaskDepth is how many levels of subtasks may hang below a top-level task.
+const MaxTaskDepth = 4
+
+var (
+	ErrParentNotFound      = errors.New("parent task not found")
+	ErrSubtaskTooDeep      = errors.New("subtasks are nested too deep")
+	ErrSubtaskCycle        = errors.New("task cannot be moved under itself or its subtask")
+	ErrSubtaskOwnerChanged = errors.New("subtask must belong to the same owner as its parent")
+)
+
+// TaskTree is a task with its subtasks embedded recursively.
+type TaskTree struct {
+	model.Task
+	Tags     []model.Tag `json:"tags"`
+	Subtasks []*TaskTree `json:"subtasks"`
+}
+
+// ancestors returns the parent chain of task, nearest first.
+func ancestors(db *gorm.DB, task *model.Task) ([]model.Task, error) {
+	var chain []model.Task
+	parentID := task.ParentID
+	for parentID != nil {
+		if len(chain) > MaxTaskDepth {
+			return nil, ErrSubtaskCycle
+		}
+		var parent model.Task
+		if err := db.First(&parent, *parentID).Error; err != nil {
+			return nil, err
+		}
+		chain = append(chain, parent)
+		parentID = parent.ParentID
+	}
+	return chain, nil
+}
+
+// descendants returns the subtasks of the given tasks level by level.
+func descendants(db *gorm.DB, ids []uint) ([][]model.Task, error) {
+	var levels [][]model.Task
+	for len(ids) > 0 {
+		if len(levels) > MaxTaskDepth {
+			return nil, ErrSubtaskCycle
+		}
+		var children []model.Task
+		if err := db.Where("parent_id IN ?", ids).Order("id").Find(&children).Error; err != nil {
+			return nil, err
+		}
+		if len(children) == 0 {
+			break
+		}
+		levels = append(levels, children)
+		ids = taskIDs(children)
+	}
+	return levels, nil
+}
+
+func taskIDs(tasks []model.Task) []uint {
+	ids := make([]uint, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// checkParent validates placing task (with its whole subtree) under parent.
+func checkParent(db *gorm.DB, task, parent *model.Task) error {
+	if parent.UserID != task.UserID {
+		return ErrSubtaskOwnerChanged
+	}
+
+	chain, err := ancestors(db, parent)
+	if err != nil {
+		return err
+	}
+	if task.ID != 0 {
+		if parent.ID == task.ID {
+			return ErrSubtaskCycle
+		}
+		for _, a := range chain {
+			if a.ID == task.ID {
+				return ErrSubtaskCycle
+			}
+		}
+	}
+
+	height := 0
+	if task.ID != 0 {
+		levels, err := descendants(db, []uint{task.ID})
+		if err != nil {
+			return err
+		}
+		height = len(levels)
+	}
+	if len(chain)+1+height > MaxTaskDepth {
+		return ErrSubtaskTooDeep
+	}
+	return nil
+}
+
+// syncParent completes an auto-completing parent once all of its subtasks
+// are done, and reopens it when one of them is reopened or added.
+func syncParent(tx *gorm.DB, parentID uint) error {
+	var parent model.Task
+	if err := tx.First(&parent, parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !parent.AutoComplete {
+		return nil
+	}
+
+	var total, open int64
+	if err := tx.Model(&model.Task{}).Where("parent_id = ?", parentID).Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	err := tx.Model(&model.Task{}).Where("parent_id = ? AND is_ready = ?", parentID, false).Count(&open).Error
+	if err != nil {
+		return err
+	}
+
+	_, err = setReady(tx, &parent, open == 0)
+	return err
+}
+
+// syncTree re-evaluates auto-completion after a task was edited: for the
+// task itself and, if it moved, for its old and new parents. The task is
+// reloaded because syncing may have changed its state.
+func syncTree(tx *gorm.DB, task *model.Task, oldParentID *uint) error {
+	if task.AutoComplete {
+		if err := syncParent(tx, task.ID); err != nil {
+			return err
+		}
+	}
+
+	moved := (oldParentID == nil) != (task.ParentID == nil) ||
+		(oldParentID != nil && task.ParentID != nil && *oldParentID != *task.ParentID)
+	if moved {
+		if oldParentID != nil {
+			if err := syncParent(tx, *oldParentID); err != nil {
+				return err
+			}
+		}
+		if task.ParentID != nil {
+			if err := syncParent(tx, *task.ParentID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.First(task, task.ID).Error
+}
+
+// GetTaskTree loads a task with all of its subtasks embedded.
+func (s *TaskService) GetTaskTree(taskID, userID uint) (*TaskTree, model.Role, error) {
+	task, role, err := s.GetTask(taskID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	levels, err := descendants(s.db, []uint{task.ID})
+	if err != nil {
+		return nil, "", err
+	}
+
+	root := &TaskTree{Task: *task, Subtasks: []*TaskTree{}}
+	nodes := map[uint]*TaskTree{task.ID: root}
+	for _, level := range levels {
+		for _, child := range level {
+			node := &TaskTree{Task: child, Subtasks: []*TaskTree{}}
+			nodes[child.ID] = node
+			parent := nodes[*child.ParentID]
+			parent.Subtasks = append(parent.Subtasks, node)
+		}
+	}
+
+	ids := make([]uint, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	tags, err := tagsByTask(s.db, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	for id, node := range nodes {
+		node.Tags = tags[id]
+	}
+	return root, role, nil
+}
+
+// setParent moves task under parentID, or to the top level when parentID
+// is zero. The caller needs editor rights on the new parent as well.
+func (s *TaskService) setParent(task *model.Task, parentID, userID uint) error {
+	if parentID == 0 {
+		task.ParentID = nil
+		return nil
+	}
+
+	parent, _, err := s.loadTask(parentID, userID, model.RoleEditor)
+	if err != nil {
+		if errors.Is(err, ErrTaskNotFound) {
+			return ErrParentNotFound
+		}
+		return err
+	}
+	if err := checkParent(s.db, task, parent); err != nil {
+		return err
+	}
+	task.ParentID = &parent.ID
+	return nil
+}
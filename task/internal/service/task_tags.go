@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"task/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MaxTagNameLength = 50
+	DefaultTagColor  = "#9e9e9e"
+)
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTagNameTaken    = errors.New("tag with this name already exists")
+	ErrInvalidTagName  = errors.New("tag name must be 1-50 characters")
+	ErrInvalidTagColor = errors.New("tag color must be in #rrggbb format")
+	ErrInvalidTagMode  = errors.New("tag_mode must be and or or")
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagMode string
+
+const (
+	TagModeAny TagMode = "or"
+	TagModeAll TagMode = "and"
+)
+
+func validateTag(name, color string) error {
+	if name == "" || len([]rune(name)) > MaxTagNameLength {
+		return ErrInvalidTagName
+	}
+	if !tagColorPattern.MatchString(color) {
+		return ErrInvalidTagColor
+	}
+	return nil
+}
+
+func (s *TaskService) tagNameTaken(userID, exceptID uint, name string) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.Tag{}).
+		Where("user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", userID, name, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *TaskService) loadTag(tagID, userID uint) (*model.Tag, error) {
+	var tag model.Tag
+	if err := s.db.Where("id = ? AND user_id = ?", tagID, userID).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (s *TaskService) GetTags(userID uint) ([]model.Tag, error) {
+	tags := make([]model.Tag, 0)
+	if err := s.db.Where("user_id = ?", userID).Order("LOWER(name)").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *TaskService) CreateTag(tag *model.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Color == "" {
+		tag.Color = DefaultTagColor
+	}
+	if err := validateTag(tag.Name, tag.Color); err != nil {
+		return err
+	}
+
+	taken, err := s.tagNameTaken(tag.UserID, 0, tag.Name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrTagNameTaken
+	}
+
+	return s.db.Create(tag).Error
+}
+
+// UpdateTag renames or recolors a tag. Tasks reference tags by id, so a
+// rename is visible on every tagged task at once.
+func (s *TaskService) UpdateTag(tagID, userID uint, name, color *string) (*model.Tag, error) {
+	tag, err := s.loadTag(tagID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		tag.Name = strings.TrimSpace(*name)
+	}
+	if color != nil {
+		tag.Color = *color
+	}
+	if err := validateTag(tag.Name, tag.Color); err != nil {
+		return nil, err
+	}
+
+	taken, err := s.tagNameTaken(userID, tag.ID, tag.Name)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrTagNameTaken
+	}
+
+	if err := s.db.Save(tag).Error; err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag removes a tag and detaches it from all tasks.
+func (s *TaskService) DeleteTag(tagID, userID uint) error {
+	tag, err := s.loadTag(tagID, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&model.TaskTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+}
+
+// AttachTag labels a task with one of the user's own tags.
+func (s *TaskService) AttachTag(taskID, tagID, userID uint) error {
+	if _, _, err := s.loadTask(taskID, userID, model.RoleEditor); err != nil {
+		return err
+	}
+	if _, err := s.loadTag(tagID, userID); err != nil {
+		return err
+	}
+
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.TaskTag{TaskID: taskID, TagID: tagID}).Error
+}
+
+func (s *TaskService) DetachTag(taskID, tagID, userID uint) error {
+	if _, _, err := s.loadTask(taskID, userID, model.RoleEditor); err != nil {
+		return err
+	}
+
+	result := s.db.Where("task_id = ? AND tag_id = ?", taskID, tagID).Delete(&model.TaskTag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+// tagsByTask loads the tags attached to each of the given tasks.
+func tagsByTask(db *gorm.DB, taskIDs []uint) (map[uint][]model.Tag, error) {
+	byTask := make(map[uint][]model.Tag, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return byTask, nil
+	}
+
+	var rows []struct {
+		model.Tag
+		TaskID uint
+	}
+	err := db.Table("tags").
+		Select("tags.*, task_tags.task_id").
+		Joins("JOIN task_tags ON task_tags.tag_id = tags.id").
+		Where("task_tags.task_id IN ?", taskIDs).
+		Order("LOWER(tags.name)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range taskIDs {
+		byTask[id] = []model.Tag{}
+	}
+	for _, row := range rows {
+		byTask[row.TaskID] = append(byTask[row.TaskID], row.Tag)
+	}
+	return byTask, nil
+}
+
+// tagFilter restricts query to tasks carrying the user's tags with the
+// given names: any of them for TagModeAny, all of them for TagModeAll.
+func tagFilter(query *gorm.DB, userID uint, names []string, mode TagMode) *gorm.DB {
+	seen := make(map[string]bool, len(names))
+	lowered := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			lowered = append(lowered, name)
+		}
+	}
+	if len(lowered) == 0 {
+		return query
+	}
+
+	sub := query.Session(&gorm.Session{NewDB: true}).
+		Table("task_tags").
+		Select("task_tags.task_id").
+		Joins("JOIN tags ON tags.id = task_tags.tag_id").
+		Where("tags.user_id = ? AND LOWER(tags.name) IN ?", userID, lowered).
+		Group("task_tags.task_id")
+	if mode == TagModeAll {
+		sub = sub.Having("COUNT(DISTINCT tags.id) = ?", len(lowered))
+	}
+	return query.Where("tasks.id IN (?)", sub)
+}
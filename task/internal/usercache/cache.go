@@ -0,0 +1,249 @@
+package usercache
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"task/pkg/userpb"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultTTL         = time.Minute
+	DefaultNegativeTTL = 10 * time.Second
+	// MaxEntries bounds the memory used by the cache.
+	MaxEntries = 100000
+
+	lookupTimeout = 3 * time.Second
+	maxBackoff    = 30 * time.Second
+)
+
+// metrics are published at /debug/vars under "user_cache".
+var metrics = expvar.NewMap("user_cache")
+
+type entry struct {
+	exists  bool
+	expires time.Time
+}
+
+// Cache remembers whether users exist, so that a task request asks the user
+// service at most once per TTL. Unknown, locked and soon-to-be-deleted users
+// are remembered for a shorter negative TTL. Concurrent lookups of the same
+// user share one call.
+type Cache struct {
+	client      userpb.UserServiceClient
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[uint]entry
+	// version counts invalidations. invalidated holds the version at which
+	// each user was last invalidated and cleared the version of the last
+	// Clear, so that a lookup which started before either does not store
+	// its possibly stale answer.
+	version     uint64
+	invalidated map[uint]uint64
+	cleared     uint64
+	group       singleflight.Group
+}
+
+func New(client userpb.UserServiceClient, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		client:      client,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[uint]entry),
+		invalidated: make(map[uint]uint64),
+	}
+}
+
+// NewFromEnv reads the TTLs from USER_CACHE_TTL and USER_CACHE_NEGATIVE_TTL.
+// A TTL of 0 turns that part of the cache off.
+func NewFromEnv(client userpb.UserServiceClient) *Cache {
+	return New(client, durationEnv("USER_CACHE_TTL", DefaultTTL), durationEnv("USER_CACHE_NEGATIVE_TTL", DefaultNegativeTTL))
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+// Exists reports whether the user is active. Errors are not cached.
+func (c *Cache) Exists(ctx context.Context, userID uint) (bool, error) {
+	if exists, ok := c.get(userID); ok {
+		metrics.Add("hits", 1)
+		return exists, nil
+	}
+	metrics.Add("misses", 1)
+
+	// The shared call must not fail because the first caller went away.
+	result, err, shared := c.group.Do(groupKey(userID), func() (interface{}, error) {
+		started := c.currentVersion()
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		resp, err := c.client.GetUser(ctx, &userpb.GetUserRequest{Id: uint64(userID)})
+		if err != nil {
+			metrics.Add("errors", 1)
+			return false, err
+		}
+		c.set(userID, resp.Exists, started)
+		return resp.Exists, nil
+	})
+	if shared {
+		metrics.Add("shared_lookups", 1)
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+func groupKey(userID uint) string {
+	return strconv.FormatUint(uint64(userID), 10)
+}
+
+func (c *Cache) currentVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+func (c *Cache) get(userID uint) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[userID]
+	if !ok {
+		return false, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, userID)
+		return false, false
+	}
+	return e.exists, true
+}
+
+// set stores the answer of a lookup that started at version started,
+// unless the user was invalidated since.
+func (c *Cache) set(userID uint, exists bool, started uint64) {
+	ttl := c.ttl
+	if !exists {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cleared > started || c.invalidated[userID] > started {
+		metrics.Add("stale_lookups", 1)
+		return
+	}
+	if len(c.entries) >= MaxEntries {
+		c.evictExpired()
+		if len(c.entries) >= MaxEntries {
+			c.entries = make(map[uint]entry)
+		}
+	}
+	c.entries[userID] = entry{exists: exists, expires: time.Now().Add(ttl)}
+	metrics.Set("size", intVar(len(c.entries)))
+}
+
+func (c *Cache) evictExpired() {
+	now := time.Now()
+	for id, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// Invalidate forgets what is known about a user, including the answer of a
+// lookup still in flight. Later calls to Exists ask the user service anew.
+func (c *Cache) Invalidate(userID uint) {
+	c.mu.Lock()
+	c.version++
+	c.invalidated[userID] = c.version
+	if len(c.invalidated) > MaxEntries {
+		// Treating it as a Clear for lookups in flight is safe.
+		c.invalidated = make(map[uint]uint64)
+		c.cleared = c.version
+	}
+	delete(c.entries, userID)
+	metrics.Add("invalidations", 1)
+	metrics.Set("size", intVar(len(c.entries)))
+	c.mu.Unlock()
+
+	c.group.Forget(groupKey(userID))
+}
+
+// Clear forgets everything, for when invalidations may have been missed.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.cleared = c.version
+	c.invalidated = make(map[uint]uint64)
+	c.entries = make(map[uint]entry)
+	metrics.Set("size", intVar(0))
+}
+
+// Watch applies the invalidations pushed by the user service until ctx is
+// done, reconnecting with backoff. The cache is cleared on every
+// (re)connect because changes made in between are not replayed.
+func (c *Cache) Watch(ctx context.Context) {
+	backoff := time.Second
+	for {
+		received, err := c.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = time.Second
+		}
+		log.Printf("user change stream closed: %v, reconnecting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// watch reads one stream; received tells whether any change arrived.
+func (c *Cache) watch(ctx context.Context) (received bool, err error) {
+	stream, err := c.client.WatchUserChanges(ctx, &userpb.WatchUserChangesRequest{})
+	if err != nil {
+		return false, err
+	}
+	c.Clear()
+
+	for {
+		change, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		c.Invalidate(uint(change.UserId))
+	}
+}
+
+func intVar(n int) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(int64(n))
+	return v
+}
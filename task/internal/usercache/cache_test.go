@@ -0,0 +1,83 @@
+package usercache
+
+import (
+	"context"
+	"sync/atomic"
+	"task/pkg/userpb"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// fakeUsers answers GetUser with exists. Each call first waits for a value
+// on release, if that is set.
+type fakeUsers struct {
+	userpb.UserServiceClient
+	exists  atomic.Bool
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *fakeUsers) GetUser(context.Context, *userpb.GetUserRequest, ...grpc.CallOption) (*userpb.GetUserResponse, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		f.started <- struct{}{}
+		<-f.release
+	}
+	return &userpb.GetUserResponse{Exists: f.exists.Load()}, nil
+}
+
+func TestExistsCaches(t *testing.T) {
+	users := &fakeUsers{}
+	users.exists.Store(true)
+	c := New(users, time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if exists, err := c.Exists(context.Background(), 1); err != nil || !exists {
+			t.Fatalf("Exists = %v, %v", exists, err)
+		}
+	}
+	if n := users.calls.Load(); n != 1 {
+		t.Fatalf("%d lookups, want 1", n)
+	}
+
+	users.exists.Store(false)
+	c.Invalidate(1)
+	if exists, _ := c.Exists(context.Background(), 1); exists {
+		t.Error("invalidated user still exists")
+	}
+	if n := users.calls.Load(); n != 2 {
+		t.Errorf("%d lookups, want 2", n)
+	}
+}
+
+func TestInvalidateDuringLookup(t *testing.T) {
+	for _, invalidate := range []func(*Cache){
+		func(c *Cache) { c.Invalidate(1) },
+		func(c *Cache) { c.Clear() },
+	} {
+		users := &fakeUsers{started: make(chan struct{}), release: make(chan struct{})}
+		users.exists.Store(true)
+		c := New(users, time.Minute, time.Minute)
+
+		done := make(chan bool)
+		go func() {
+			exists, _ := c.Exists(context.Background(), 1)
+			done <- exists
+		}()
+
+		// The user is locked while the lookup is on the wire, so its
+		// answer is stale by the time it arrives.
+		<-users.started
+		users.exists.Store(false)
+		invalidate(c)
+		users.release <- struct{}{}
+		<-done
+
+		if _, ok := c.get(1); ok {
+			t.Error("the stale answer was cached")
+		}
+	}
+}
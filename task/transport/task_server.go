@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"context"
+	"task/internal/service"
+	"task/pkg/taskpb"
+
+	"gorm.io/gorm"
+)
+
+type TaskServiceServer struct {
+	taskpb.UnimplementedTaskServiceServer
+	taskService *service.TaskService
+}
+
+func NewTaskServiceServer(db *gorm.DB) *TaskServiceServer {
+	return &TaskServiceServer{
+		taskService: service.NewTaskService(db),
+	}
+}
+
+func (s *TaskServiceServer) DeleteUserTasks(ctx context.Context, req *taskpb.DeleteUserTasksRequest) (*taskpb.DeleteUserTasksResponse, error) {
+	deleted, err := s.taskService.DeleteUserData(uint(req.UserId))
+	if err != nil {
+		return nil, err
+	}
+
+	return &taskpb.DeleteUserTasksResponse{
+		DeletedTasks: deleted,
+	}, nil
+}
@@ -38,7 +38,7 @@ func (uc *UserClient) Close() {
 	}
 }
 
-func (uc *UserClient) CheckUser(ctx context.Context, id string) (bool, error) {
+func (uc *UserClient) CheckUser(ctx context.Context, id uint64) (bool, error) {
 	// We are waiting for an answer 3 seconds
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
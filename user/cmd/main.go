@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
+	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"jwtauth"
 	"log"
 	"net"
+	"os"
+	"time"
+	"user/internal/handler"
 	"user/internal/model"
+	"user/internal/notify"
+	"user/internal/service"
+	"user/middleware"
 	"user/pkg/auth_user_pb"
+	"user/pkg/taskpb"
 	"user/pkg/userpb"
 	"user/transport"
 )
@@ -16,17 +27,61 @@ func main() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	serviceToken := os.Getenv("USER_SERVICE_TOKEN")
+	if serviceToken == "" {
+		log.Fatal("USER_SERVICE_TOKEN is not set")
+	}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(transport.RequireServiceToken(serviceToken)))
 	userpb.RegisterUserServiceServer(grpcServer, transport.NewUserServiceServer(db))
-	auth_user_pb.RegisterAuthServiceServer(grpcServer, transport.NewUserAuthServer(db))
+	mailer, err := notify.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("failed to set up mail: %v", err)
+	}
+	notifier := notify.NewMailNotifier(mailer)
+	auth_user_pb.RegisterAuthServiceServer(grpcServer, transport.NewUserAuthServer(db, notifier))
+
+	taskAddr := os.Getenv("TASK_SERVICE_ADDR")
+	if taskAddr == "" {
+		taskAddr = "localhost:50052"
+	}
+	taskConn, err := grpc.Dial(taskAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to connect to the task service: %v", err)
+	}
+	defer taskConn.Close()
+
+	// Accounts past their deletion grace period are purged in the background
+	go transport.RunAccountPurger(context.Background(), service.NewUserService(db), taskpb.NewTaskServiceClient(taskConn), time.Minute)
+
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL is not set")
+	}
+	verifier := jwtauth.NewVerifier(jwtauth.NewJWKSClient(jwksURL).Keyfunc, jwtauth.AudienceUser)
 
 	listener, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	log.Println("Starting gRPC server on :50051")
-	err = grpcServer.Serve(listener)
-	if err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	go func() {
+		log.Println("Starting gRPC server on :50051")
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	r := gin.Default()
+
+	userHandler := handler.NewUserHandler(service.NewUserService(db), notifier)
+
+	authorized := r.Group("/")
+	authorized.Use(middleware.AuthMiddleware(verifier))
+	{
+		authorized.GET("/me", userHandler.GetMe)
+		authorized.PATCH("/me", userHandler.UpdateMe)
+	}
+
+	if err := r.Run(":8082"); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -1,11 +1,105 @@
 package handler
 
-import "user/internal/service"
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"user/internal/model"
+	"user/internal/notify"
+	"user/internal/policy"
+	"user/internal/service"
+)
 
 type UserHandler struct {
-	s *service.UserService
+	s        *service.UserService
+	notifier notify.Notifier
 }
 
-func NewUserHandler(s *service.UserService) *UserHandler {
-	return &UserHandler{s: s}
+func NewUserHandler(s *service.UserService, notifier notify.Notifier) *UserHandler {
+	return &UserHandler{s: s, notifier: notifier}
+}
+
+func profileJSON(user *model.User) gin.H {
+	return gin.H{
+		"id":             user.ID,
+		"username":       user.Username,
+		"name":           user.Name,
+		"email":          user.Email,
+		"timezone":       user.Timezone,
+		"locale":         user.Locale,
+		"avatar_url":     user.AvatarURL,
+		"role":           service.Roles(user)[0],
+		"email_verified": user.EmailVerifiedAt != nil,
+	}
+}
+
+func profileFailure(c *gin.Context, err error) {
+	var verr *policy.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		fields := make([]gin.H, 0, len(verr.Errors))
+		for _, fe := range verr.Errors {
+			fields = append(fields, gin.H{"field": fe.Field, "code": fe.Code, "message": fe.Message})
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": fields})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
+
+// GetMe returns the profile of the signed-in user.
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, err := h.s.GetProfile(c.GetUint("userID"))
+	if err != nil {
+		profileFailure(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, profileJSON(user))
+}
+
+// UpdateMe changes the fields present in the body; an empty string clears
+// a field.
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var input struct {
+		Username  *string `json:"username"`
+		Name      *string `json:"name"`
+		Email     *string `json:"email"`
+		Timezone  *string `json:"timezone"`
+		Locale    *string `json:"locale"`
+		AvatarURL *string `json:"avatar_url"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.s.UpdateProfile(c.GetUint("userID"), service.ProfileUpdate{
+		Username:  input.Username,
+		Name:      input.Name,
+		Email:     input.Email,
+		Timezone:  input.Timezone,
+		Locale:    input.Locale,
+		AvatarURL: input.AvatarURL,
+	})
+	if err != nil {
+		profileFailure(c, err)
+		return
+	}
+
+	// A new address gets its verification email right away. Failing to send
+	// it does not undo the update: the user can ask for another one.
+	if input.Email != nil && user.Email != "" && user.EmailVerifiedAt == nil {
+		if verified, token, err := h.s.CreateEmailVerification(user.ID); err == nil {
+			if err := h.notifier.SendEmailVerification(verified, token); err != nil {
+				log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, profileJSON(user))
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ExternalIdentity links a user to an account at an OIDC provider. A user
+// has at most one identity per provider.
+type ExternalIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_identities_user_provider"`
+	Provider  string `gorm:"not null;uniqueIndex:idx_identities_user_provider;uniqueIndex:idx_identities_provider_subject"`
+	Subject   string `gorm:"not null;uniqueIndex:idx_identities_provider_subject"`
+	Email     string
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Login throttle kinds: failures are counted per username and per client IP.
+const (
+	ThrottleUsername = "username"
+	ThrottleIP       = "ip"
+)
+
+// LoginThrottle counts recent failed logins for a username or an IP.
+// Usernames are tracked whether or not the account exists, so throttling
+// does not reveal which usernames are registered.
+type LoginThrottle struct {
+	Kind          string `gorm:"primaryKey"`
+	Key           string `gorm:"primaryKey"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	BlockedUntil  *time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// PasswordResetToken is a single-use token for resetting a forgotten
+// password. Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// PasswordResetThrottle counts the reset requests made from one client IP
+// in the current fixed window.
+type PasswordResetThrottle struct {
+	IP          string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"not null"`
+	Requests    int       `gorm:"not null;default:0"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// RecoveryCode is a single-use fallback for a lost authenticator. Only the
+// SHA-256 hash of the code is stored; UsedAt is set once it has been redeemed.
+type RecoveryCode struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	CodeHash  string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UsedAt    *time.Time
+}
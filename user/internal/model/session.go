@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Session is a login on one device. It stays alive as long as its refresh
+// tokens keep being rotated before they expire.
+type Session struct {
+	ID         uint `gorm:"primaryKey"`
+	UserID     uint `gorm:"not null;index"`
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	LastUsedAt time.Time
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
+
+// RefreshToken is one link in a session's rotation chain. Only the SHA-256
+// hash of the token is stored; UsedAt is set once it has been exchanged.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	SessionID uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UsedAt    *time.Time
+}
+
+// LoginTicket proves to CreateSession that the user has just passed a
+// login. Only the hash is stored, and the row is deleted when it is used.
+type LoginTicket struct {
+	TicketHash string    `gorm:"primaryKey"`
+	UserID     uint      `gorm:"not null;index"`
+	ExpiresAt  time.Time `gorm:"not null"`
+}
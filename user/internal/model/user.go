@@ -4,16 +4,54 @@ import (
 	"fmt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"log"
 	"os"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
 )
 
 type User struct {
 	ID       uint   `gorm:"primaryKey" json:"id"`
 	Username string `gorm:"unique" json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
-	GoogleID string `gorm:"uniqueIndex" json:"google_id,omitempty"`
-	Email    string `gorm:"uniqueIndex" json:"email,omitempty"`
+	GoogleID string `json:"google_id,omitempty"`
+	Email    string `json:"email,omitempty"`
 	Name     string `json:"name,omitempty"`
+	Role     Role   `gorm:"not null;default:user" json:"role"`
+	// EmailVerifiedAt is set once the user has proved they own Email; it is
+	// cleared whenever the email changes.
+	EmailVerifiedAt         *time.Time `json:"email_verified_at,omitempty"`
+	EmailVerificationSentAt *time.Time `json:"-"`
+	PasswordResetSentAt     *time.Time `json:"-"`
+	// Profile settings; empty means the client default.
+	Timezone  string `json:"timezone,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// LockedAt is set while an admin has locked the account.
+	LockedAt   *time.Time `json:"locked_at,omitempty"`
+	LockReason string     `json:"lock_reason,omitempty"`
+	// TOTPSecret is stored as soon as enrollment starts; TOTPEnabledAt is
+	// set once the user has confirmed it with a valid code.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	// TOTPLastStep is the time step of the last accepted code, so the same
+	// code cannot be used twice.
+	TOTPLastStep int64 `json:"-"`
+	// DeletionDueAt is set while the account waits out its deletion grace period.
+	DeletionDueAt *time.Time `json:"deletion_due_at,omitempty"`
+}
+
+// PendingTaskCleanup records a purged user whose tasks still have to be
+// removed from the task service.
+type PendingTaskCleanup struct {
+	UserID    uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
 func ConnectDB() (*gorm.DB, error) {
@@ -34,9 +72,58 @@ func ConnectDB() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&User{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &PasswordResetToken{}, &PendingTaskCleanup{}, &Session{}, &RefreshToken{}, &AuditLog{}, &ExternalIdentity{}, &RecoveryCode{}, &LoginThrottle{}, &PasswordResetThrottle{}, &LoginTicket{}); err != nil {
+		return nil, err
+	}
+
+	// Google ID and email are optional, so uniqueness only applies to set
+	// values. The old full unique indexes made every user after the first
+	// collide on the empty string. An email only belongs to an account once
+	// it is verified; otherwise anyone could claim someone else's address.
+	for _, stmt := range []string{
+		"DROP INDEX IF EXISTS idx_users_google_id",
+		"DROP INDEX IF EXISTS idx_users_email",
+		"DROP INDEX IF EXISTS idx_users_email_set",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_google_id_set ON users (google_id) WHERE google_id <> ''",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_verified ON users (LOWER(email)) WHERE email <> '' AND email_verified_at IS NOT NULL",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := createUsernameIndex(db); err != nil {
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// createUsernameIndex makes usernames unique regardless of case. Accounts
+// created before that rule may differ only in case; then the index is left
+// out and the collisions are logged, and it is created on the first start
+// after they have been renamed. Until then the service still refuses new
+// collisions itself.
+func createUsernameIndex(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&User{}, "idx_users_username_lower") {
+		return nil
+	}
+
+	var collisions []struct {
+		Name string
+		IDs  string
+	}
+	err := db.Raw(`SELECT LOWER(username) AS name, string_agg(id::text, ', ' ORDER BY id) AS ids
+		FROM users GROUP BY LOWER(username) HAVING COUNT(*) > 1`).Scan(&collisions).Error
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		for _, c := range collisions {
+			log.Printf("username %q is used by users %s in different case; rename all but one of them", c.Name, c.IDs)
+		}
+		log.Printf("idx_users_username_lower not created: %d usernames collide", len(collisions))
+		return nil
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username))").Error
+}
@@ -0,0 +1,51 @@
+// Package notify delivers messages such as password reset tokens to users.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"user/internal/model"
+)
+
+// ErrUnverifiedEmail is returned when a message would go to an address the
+// user has not verified.
+var ErrUnverifiedEmail = errors.New("email address is not verified")
+
+type Notifier interface {
+	SendPasswordReset(user *model.User, token string) error
+	SendEmailVerification(user *model.User, token string) error
+}
+
+// MailNotifier sends notifications by email through a Mailer.
+type MailNotifier struct {
+	mailer Mailer
+}
+
+func NewMailNotifier(mailer Mailer) *MailNotifier {
+	return &MailNotifier{mailer: mailer}
+}
+
+func (n *MailNotifier) SendPasswordReset(user *model.User, token string) error {
+	if user.Email == "" || user.EmailVerifiedAt == nil {
+		return ErrUnverifiedEmail
+	}
+	return n.mailer.Send(Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\nUse this token to reset your password: %s\n"+
+			"If you did not ask for a reset, ignore this message.\n", user.Username, token),
+	})
+}
+
+// SendEmailVerification is the one message that goes to an unverified
+// address: it is how the address gets verified.
+func (n *MailNotifier) SendEmailVerification(user *model.User, token string) error {
+	if user.Email == "" {
+		return ErrUnverifiedEmail
+	}
+	return n.mailer.Send(Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf("Hello, %s!\n\nUse this token to confirm your email address: %s\n", user.Username, token),
+	})
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Character classes a password can be required to contain.
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+// MaxPasswordLength is bcrypt's limit: longer passwords would be silently truncated.
+const MaxPasswordLength = 72
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var (
+	commonOnce      sync.Once
+	commonPasswords map[string]struct{}
+)
+
+func isCommon(password string) bool {
+	commonOnce.Do(func() {
+		commonPasswords = make(map[string]struct{})
+		for _, line := range strings.Split(commonPasswordList, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				commonPasswords[line] = struct{}{}
+			}
+		}
+	})
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+type PasswordPolicy struct {
+	MinLength       int
+	RequiredClasses []string
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:       10,
+	RequiredClasses: []string{ClassLower, ClassUpper, ClassDigit},
+}
+
+// PasswordPolicyFromEnv applies PASSWORD_MIN_LENGTH and PASSWORD_REQUIRED_CLASSES
+// (a comma-separated list of lower, upper, digit, symbol; empty for none)
+// on top of DefaultPasswordPolicy.
+func PasswordPolicyFromEnv() PasswordPolicy {
+	policy := DefaultPasswordPolicy
+
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 || length > MaxPasswordLength {
+			log.Printf("invalid PASSWORD_MIN_LENGTH %q, using default %d", value, policy.MinLength)
+		} else {
+			policy.MinLength = length
+		}
+	}
+
+	if value, ok := os.LookupEnv("PASSWORD_REQUIRED_CLASSES"); ok {
+		classes := make([]string, 0, 4)
+		valid := true
+		for _, class := range strings.Split(value, ",") {
+			class = strings.TrimSpace(class)
+			switch class {
+			case "":
+			case ClassLower, ClassUpper, ClassDigit, ClassSymbol:
+				classes = append(classes, class)
+			default:
+				valid = false
+			}
+		}
+		if valid {
+			policy.RequiredClasses = classes
+		} else {
+			log.Printf("invalid PASSWORD_REQUIRED_CLASSES %q, using default %v", value, policy.RequiredClasses)
+		}
+	}
+
+	return policy
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch {
+		case class == ClassLower && unicode.IsLower(r),
+			class == ClassUpper && unicode.IsUpper(r),
+			class == ClassDigit && unicode.IsDigit(r),
+			class == ClassSymbol && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r):
+			return true
+		}
+	}
+	return false
+}
+
+// Check validates a new password for the given user. field names the
+// request field, e.g. "password" or "new_password".
+func (p PasswordPolicy) Check(field, password, username string) error {
+	errs := &ValidationError{}
+
+	if password == "" {
+		errs.Add(field, CodeRequired, "password is required")
+		return errs
+	}
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		errs.Add(field, CodeTooShort, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > MaxPasswordLength {
+		errs.Add(field, CodeTooLong, fmt.Sprintf("password must be at most %d bytes long", MaxPasswordLength))
+	}
+
+	var missing []string
+	for _, class := range p.RequiredClasses {
+		if !hasClass(password, class) {
+			missing = append(missing, class)
+		}
+	}
+	if len(missing) > 0 {
+		errs.Add(field, CodeMissingClass, "password must contain "+strings.Join(missing, ", ")+" characters")
+	}
+
+	name := strings.ToLower(strings.TrimSpace(username))
+	if len(name) >= MinUsernameLength && strings.Contains(strings.ToLower(password), name) {
+		errs.Add(field, CodeContainsName, "password must not contain the username")
+	}
+
+	if isCommon(password) {
+		errs.Add(field, CodeCommon, "password is too common")
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		username string
+		want     []string
+	}{
+		{"valid", DefaultPasswordPolicy, "Correct7Horse", "alice", nil},
+		{"empty", DefaultPasswordPolicy, "", "alice", []string{CodeRequired}},
+		{"short", DefaultPasswordPolicy, "Sh0rt", "alice", []string{CodeTooShort}},
+		// Length is counted in characters, the bcrypt limit in bytes.
+		{"multibyte length", DefaultPasswordPolicy, "Пароль1Abc", "alice", nil},
+		{"over the bcrypt limit", DefaultPasswordPolicy, "Aa1" + strings.Repeat("ж", 35), "alice", []string{CodeTooLong}},
+		{"missing classes", DefaultPasswordPolicy, "alllowercase", "alice", []string{CodeMissingClass}},
+		{"contains username", DefaultPasswordPolicy, "MyAlice2024x", "ALICE", []string{CodeContainsName}},
+		{"short username is ignored", DefaultPasswordPolicy, "MyAl2024xyz", "al", nil},
+		{"common, in any case", PasswordPolicy{MinLength: 6}, "QWERTY123", "alice", []string{CodeCommon}},
+		{"symbol class", PasswordPolicy{MinLength: 1, RequiredClasses: []string{ClassSymbol}}, "abc def", "alice", []string{CodeMissingClass}},
+		{"symbol present", PasswordPolicy{MinLength: 1, RequiredClasses: []string{ClassSymbol}}, "abc#def", "alice", nil},
+		{"everything wrong", DefaultPasswordPolicy, "alice", "alice", []string{CodeTooShort, CodeMissingClass, CodeContainsName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(t, tt.policy.Check("password", tt.password, tt.username))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		minLength string
+		classes   *string
+		want      PasswordPolicy
+	}{
+		{"", nil, DefaultPasswordPolicy},
+		{"12", nil, PasswordPolicy{MinLength: 12, RequiredClasses: DefaultPasswordPolicy.RequiredClasses}},
+		{"0", nil, DefaultPasswordPolicy},
+		{"73", nil, DefaultPasswordPolicy},
+		{"x", nil, DefaultPasswordPolicy},
+		{"", strPtr(""), PasswordPolicy{MinLength: DefaultPasswordPolicy.MinLength, RequiredClasses: []string{}}},
+		{"", strPtr(" symbol, digit "), PasswordPolicy{MinLength: DefaultPasswordPolicy.MinLength, RequiredClasses: []string{ClassSymbol, ClassDigit}}},
+		{"", strPtr("digit,emoji"), DefaultPasswordPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.minLength, func(t *testing.T) {
+			t.Setenv("PASSWORD_MIN_LENGTH", tt.minLength)
+			// An unset variable keeps the default; an empty one requires nothing.
+			t.Setenv("PASSWORD_REQUIRED_CLASSES", "")
+			if tt.classes == nil {
+				os.Unsetenv("PASSWORD_REQUIRED_CLASSES")
+			} else {
+				t.Setenv("PASSWORD_REQUIRED_CLASSES", *tt.classes)
+			}
+
+			got := PasswordPolicyFromEnv()
+			if got.MinLength != tt.want.MinLength || strings.Join(got.RequiredClasses, ",") != strings.Join(tt.want.RequiredClasses, ",") {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
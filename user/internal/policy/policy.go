@@ -0,0 +1,66 @@
+// Package policy holds the rules new usernames and passwords must follow.
+package policy
+
+import "strings"
+
+// Violation codes returned to clients, stable enough to switch on.
+const (
+	CodeRequired     = "required"
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeInvalidChars = "invalid_characters"
+	CodeInvalidStart = "invalid_start"
+	CodeMissingClass = "missing_character_class"
+	CodeContainsName = "contains_username"
+	CodeCommon       = "too_common"
+	CodeTaken        = "taken"
+	CodeMismatch     = "mismatch"
+	CodeInvalid      = "invalid"
+)
+
+// FieldError is one rule a field breaks.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// ValidationError collects every rule the input breaks, so a form can
+// show them all at once.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		messages = append(messages, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Err returns nil if nothing was added.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Merge appends the violations of another check. err may be nil.
+func (e *ValidationError) Merge(err error) {
+	if other, ok := err.(*ValidationError); ok {
+		e.Errors = append(e.Errors, other.Errors...)
+	}
+}
+
+// Field returns a validation error for a single field.
+func Field(field, code, message string) *ValidationError {
+	e := &ValidationError{}
+	e.Add(field, code, message)
+	return e
+}
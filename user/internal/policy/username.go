@@ -0,0 +1,41 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+)
+
+var (
+	usernameChars = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	usernameStart = regexp.MustCompile(`^[A-Za-z0-9]`)
+)
+
+// CheckUsername validates the format of a username. Uniqueness is checked
+// by the user service, case-insensitively.
+func CheckUsername(field, username string) error {
+	errs := &ValidationError{}
+
+	if username == "" {
+		errs.Add(field, CodeRequired, "username is required")
+		return errs
+	}
+
+	if len(username) < MinUsernameLength {
+		errs.Add(field, CodeTooShort, fmt.Sprintf("username must be at least %d characters long", MinUsernameLength))
+	}
+	if len(username) > MaxUsernameLength {
+		errs.Add(field, CodeTooLong, fmt.Sprintf("username must be at most %d characters long", MaxUsernameLength))
+	}
+	if !usernameChars.MatchString(username) {
+		errs.Add(field, CodeInvalidChars, "username may only contain latin letters, digits, '.', '_' and '-'")
+	} else if !usernameStart.MatchString(username) {
+		errs.Add(field, CodeInvalidStart, "username must start with a letter or digit")
+	}
+
+	return errs.Err()
+}
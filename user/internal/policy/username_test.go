@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// codes returns the violation codes of err, in order.
+func codes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+	var out []string
+	for _, fe := range verr.Errors {
+		out = append(out, fe.Code)
+	}
+	return out
+}
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     []string
+	}{
+		{"alice", nil},
+		{"Alice.Smith-2_x", nil},
+		{"a1b", nil},
+		{strings.Repeat("a", MaxUsernameLength), nil},
+		{"", []string{CodeRequired}},
+		{"ab", []string{CodeTooShort}},
+		{strings.Repeat("a", MaxUsernameLength+1), []string{CodeTooLong}},
+		{"_alice", []string{CodeInvalidStart}},
+		{"alice smith", []string{CodeInvalidChars}},
+		{"алиса", []string{CodeInvalidChars}},
+		{"a!", []string{CodeTooShort, CodeInvalidChars}},
+	}
+	for _, tt := range tests {
+		err := CheckUsername("username", tt.username)
+		if got := codes(t, err); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("CheckUsername(%q) = %v, want %v", tt.username, got, tt.want)
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	errs := &ValidationError{}
+	if errs.Err() != nil {
+		t.Fatal("empty ValidationError is an error")
+	}
+
+	errs.Add("password", CodeTooShort, "too short")
+	errs.Merge(Field("username", CodeTaken, "taken"))
+	errs.Merge(nil)
+	errs.Merge(errors.New("not a validation error"))
+
+	err := errs.Err()
+	if got := codes(t, err); strings.Join(got, ",") != CodeTooShort+","+CodeTaken {
+		t.Errorf("codes = %v", got)
+	}
+	if want := "validation failed: password: too short; username: taken"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultDeletionGrace = 7 * 24 * time.Hour
+	// RecentLoginWindow is how fresh a login must be to stand in for the
+	// password of an account that has none.
+	RecentLoginWindow = 10 * time.Minute
+)
+
+var (
+	ErrAccountPendingDeletion = errors.New("account is scheduled for deletion")
+	ErrAccountNotPending      = errors.New("account is not scheduled for deletion")
+	ErrReauthRequired         = errors.New("log in again or enter a two-factor code to confirm")
+)
+
+// deletionGrace reads the grace period from ACCOUNT_DELETION_GRACE
+// (a Go duration such as "168h"), falling back to DefaultDeletionGrace.
+func deletionGrace() time.Duration {
+	value := os.Getenv("ACCOUNT_DELETION_GRACE")
+	if value == "" {
+		return DefaultDeletionGrace
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		log.Printf("invalid ACCOUNT_DELETION_GRACE %q, using default %s", value, DefaultDeletionGrace)
+		return DefaultDeletionGrace
+	}
+	return grace
+}
+
+// ScheduleDeletion re-authenticates the user and marks the account for
+// deletion once the grace period is over. Until then it can be restored.
+// Accounts without a password, such as Google-only ones, confirm with code
+// or a recent login on sessionID instead.
+func (s *UserService) ScheduleDeletion(userID, sessionID uint, password, code string) (time.Time, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.DeletionDueAt != nil {
+		return time.Time{}, ErrAccountPendingDeletion
+	}
+	if user.Password != "" && !comparePassword(user.Password, password) {
+		return time.Time{}, ErrInvalidCredentials
+	}
+
+	due := time.Now().Add(deletionGrace())
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if user.Password == "" {
+			if err := reauthenticate(tx, user, sessionID, code); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(user).Update("deletion_due_at", due).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, user.ID)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	publishChange(user.ID, ChangeDeletionScheduled)
+	return due, nil
+}
+
+// reauthenticate checks that a user without a password has just proved who
+// they are: with a second-factor code, which is used up, or by having
+// logged in within RecentLoginWindow on the given session.
+func reauthenticate(tx *gorm.DB, user *model.User, sessionID uint, code string) error {
+	if code != "" {
+		if !TwoFactorEnabled(user) {
+			return ErrTOTPNotEnabled
+		}
+		return useSecondFactor(tx, user, code)
+	}
+
+	var session model.Session
+	err := tx.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND created_at > ?",
+		sessionID, user.ID, time.Now().Add(-RecentLoginWindow)).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrReauthRequired
+	}
+	return err
+}
+
+// RestoreAccount cancels a scheduled deletion.
+func (s *UserService) RestoreAccount(username, password string) (*model.User, error) {
+	user, err := s.VerifyCredentials(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionDueAt == nil {
+		return nil, ErrAccountNotPending
+	}
+
+	if err := s.db.Model(user).Update("deletion_due_at", nil).Error; err != nil {
+		return nil, err
+	}
+	user.DeletionDueAt = nil
+	publishChange(user.ID, ChangeRestored)
+	return user, nil
+}
+
+// PurgeDueAccounts deletes accounts whose grace period is over and queues
+// the cleanup of their tasks. Returns the number of purged accounts.
+func (s *UserService) PurgeDueAccounts() (int, error) {
+	var users []model.User
+	if err := s.db.Where("deletion_due_at <= ?", time.Now()).Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.PasswordResetToken{}).Error; err != nil {
+				return err
+			}
+			sessions := tx.Model(&model.Session{}).Select("id").Where("user_id = ?", user.ID)
+			if err := tx.Where("session_id IN (?)", sessions).Delete(&model.RefreshToken{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.Session{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.ExternalIdentity{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&model.User{}, user.ID).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.PendingTaskCleanup{UserID: user.ID}).Error
+		})
+		if err != nil {
+			return 0, err
+		}
+		publishChange(user.ID, ChangeDeleted)
+	}
+	return len(users), nil
+}
+
+func (s *UserService) PendingTaskCleanups() ([]uint, error) {
+	var ids []uint
+	if err := s.db.Model(&model.PendingTaskCleanup{}).Order("created_at").Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *UserService) CompleteTaskCleanup(userID uint) error {
+	return s.db.Delete(&model.PendingTaskCleanup{}, userID).Error
+}
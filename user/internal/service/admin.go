@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+var (
+	ErrAdminRequired    = errors.New("admin role required")
+	ErrAccountLocked    = errors.New("account is locked")
+	ErrAccountNotLocked = errors.New("account is not locked")
+	ErrCannotLockSelf   = errors.New("admins cannot lock their own account")
+)
+
+// Audit actions recorded for admin requests.
+const (
+	AuditListUsers  = "users.list"
+	AuditLockUser   = "users.lock"
+	AuditUnlockUser = "users.unlock"
+)
+
+// Roles returns the roles carried in the user's access tokens.
+func Roles(user *model.User) []string {
+	if user.Role == "" {
+		return []string{string(model.RoleUser)}
+	}
+	return []string{string(user.Role)}
+}
+
+// requireAdmin checks the actor's role in the database rather than trusting
+// the caller: a demoted admin loses access before their token expires.
+func (s *UserService) requireAdmin(actorID uint) error {
+	var count int64
+	err := s.db.Model(&model.User{}).
+		Where("id = ? AND role = ? AND locked_at IS NULL", actorID, model.RoleAdmin).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAdminRequired
+	}
+	return nil
+}
+
+func audit(tx *gorm.DB, actorID uint, action string, targetUserID uint, details string) error {
+	return tx.Create(&model.AuditLog{
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      details,
+	}).Error
+}
+
+// ListUsers returns users ordered by id, starting after afterID.
+func (s *UserService) ListUsers(actorID uint, query string, afterID uint, limit int) ([]model.User, error) {
+	if err := s.requireAdmin(actorID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultUserPageSize
+	}
+	if limit > MaxUserPageSize {
+		limit = MaxUserPageSize
+	}
+
+	db := s.db.Where("id > ?", afterID)
+	if query != "" {
+		pattern := "%" + escapeLike(query) + "%"
+		db = db.Where(`username ILIKE ? ESCAPE '\' OR email ILIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+
+	users := make([]model.User, 0)
+	if err := db.Order("id").Limit(limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	details := fmt.Sprintf("query=%q after_id=%d", query, afterID)
+	if err := audit(s.db, actorID, AuditListUsers, 0, details); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// escapeLike makes %, _ and \ in s match themselves in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// LockUser blocks logins and ends all sessions of the user.
+func (s *UserService) LockUser(actorID, userID uint, reason string) error {
+	if err := s.requireAdmin(actorID); err != nil {
+		return err
+	}
+	if actorID == userID {
+		return ErrCannotLockSelf
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.LockedAt != nil {
+		return ErrAccountLocked
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"locked_at":   time.Now(),
+			"lock_reason": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := revokeAllSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditLockUser, user.ID, reason)
+	})
+	if err != nil {
+		return err
+	}
+	publishChange(user.ID, ChangeLocked)
+	return nil
+}
+
+// UnlockUser lifts an admin lock as well as a lockout after failed logins.
+func (s *UserService) UnlockUser(actorID, userID uint) error {
+	if err := s.requireAdmin(actorID); err != nil {
+		return err
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	retryAfter, err := s.LoginRetryAfter(user.Username, "")
+	if err != nil {
+		return err
+	}
+	if user.LockedAt == nil && retryAfter == 0 {
+		return ErrAccountNotLocked
+	}
+
+	details := ""
+	if user.LockedAt == nil {
+		details = "failed login lockout"
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"locked_at":   nil,
+			"lock_reason": "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("kind = ? AND key = ?", model.ThrottleUsername, usernameKey(user.Username)).
+			Delete(&model.LoginThrottle{}).Error
+		if err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditUnlockUser, user.ID, details)
+	})
+	if err != nil {
+		return err
+	}
+	if user.LockedAt != nil {
+		publishChange(user.ID, ChangeUnlocked)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package service
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"alice":      "alice",
+		"100%":       `100\%`,
+		"john_doe":   `john\_doe`,
+		`back\slash`: `back\\slash`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import "sync"
+
+type ChangeKind string
+
+const (
+	ChangeLocked            ChangeKind = "locked"
+	ChangeUnlocked          ChangeKind = "unlocked"
+	ChangeDeletionScheduled ChangeKind = "deletion_scheduled"
+	ChangeRestored          ChangeKind = "restored"
+	ChangeDeleted           ChangeKind = "deleted"
+)
+
+// UserChange reports that a user became active or inactive, so that other
+// services can drop what they cached about the user.
+type UserChange struct {
+	UserID uint
+	Kind   ChangeKind
+}
+
+// changeBuffer is how many changes a subscriber may lag behind before it
+// is dropped.
+const changeBuffer = 64
+
+// changeHub fans changes out to subscribers. There is one per process:
+// several UserService values are in use and each may make a change.
+type changeHub struct {
+	mu          sync.Mutex
+	subscribers map[chan UserChange]struct{}
+}
+
+var userChanges = &changeHub{subscribers: make(map[chan UserChange]struct{})}
+
+// SubscribeUserChanges returns a channel of changes made from now on and a
+// function to unsubscribe. The channel is closed if the subscriber falls
+// behind; it has then missed changes and must resubscribe.
+func (s *UserService) SubscribeUserChanges() (<-chan UserChange, func()) {
+	ch := make(chan UserChange, changeBuffer)
+	userChanges.mu.Lock()
+	userChanges.subscribers[ch] = struct{}{}
+	userChanges.mu.Unlock()
+
+	return ch, func() {
+		userChanges.mu.Lock()
+		defer userChanges.mu.Unlock()
+		if _, ok := userChanges.subscribers[ch]; ok {
+			delete(userChanges.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func publishChange(userID uint, kind ChangeKind) {
+	change := UserChange{UserID: userID, Kind: kind}
+
+	userChanges.mu.Lock()
+	defer userChanges.mu.Unlock()
+	for ch := range userChanges.subscribers {
+		select {
+		case ch <- change:
+		default:
+			delete(userChanges.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"user/internal/model"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned for both an unknown username and a wrong
+// password, so callers cannot tell which one it was.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// passwordCost reads the bcrypt cost from BCRYPT_COST, falling back to the default.
+func passwordCost() int {
+	value := os.Getenv("BCRYPT_COST")
+	if value == "" {
+		return bcrypt.DefaultCost
+	}
+	cost, err := strconv.Atoi(value)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("invalid BCRYPT_COST %q, using default %d", value, bcrypt.DefaultCost)
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// burnCompare runs a bcrypt comparison that always fails, so that a login
+// for a missing user or a password-less account takes as long as a real one.
+func (s *UserService) burnCompare(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), s.hashCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// VerifyCredentials checks a username and password. On success the stored
+// hash is upgraded if it was made with a different bcrypt cost.
+func (s *UserService) VerifyCredentials(username, password string) (*model.User, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrAmbiguousUsername) {
+			s.burnCompare(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if user.Password == "" {
+		s.burnCompare(password)
+		return nil, ErrInvalidCredentials
+	}
+	if !comparePassword(user.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	if cost, err := bcrypt.Cost([]byte(user.Password)); err == nil && cost != s.hashCost {
+		if hashed, err := s.hashPassword(password); err == nil {
+			if err := s.db.Model(user).Update("password", hashed).Error; err != nil {
+				log.Printf("failed to rehash password for user %d: %v", user.ID, err)
+			} else {
+				user.Password = hashed
+			}
+		}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"user/internal/model"
+)
+
+const (
+	EmailVerificationTTL = 24 * time.Hour
+	// EmailVerificationResendInterval limits how often a user can ask for
+	// another verification email.
+	EmailVerificationResendInterval = time.Minute
+)
+
+var (
+	ErrNoEmail                  = errors.New("no email address is set")
+	ErrEmailAlreadyVerified     = errors.New("email address is already verified")
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailVerifiedElsewhere   = errors.New("email address has been verified by another account")
+)
+
+// VerificationTooSoonError is returned when a verification email was sent
+// less than EmailVerificationResendInterval ago.
+type VerificationTooSoonError struct {
+	RetryAfter time.Duration
+}
+
+func (e *VerificationTooSoonError) Error() string {
+	return "a verification email was sent recently, try again later"
+}
+
+var (
+	randomKeyOnce sync.Once
+	randomKey     []byte
+)
+
+// verificationSecret reads the HMAC key for verification tokens from
+// EMAIL_VERIFICATION_SECRET. Without it a random key is shared by the whole
+// process, so tokens stop working when the service restarts.
+func verificationSecret() []byte {
+	if secret := os.Getenv("EMAIL_VERIFICATION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	randomKeyOnce.Do(func() {
+		log.Println("EMAIL_VERIFICATION_SECRET is not set, using a random key (development only)")
+		randomKey = make([]byte, 32)
+		if _, err := rand.Read(randomKey); err != nil {
+			log.Fatalf("failed to generate verification key: %v", err)
+		}
+	})
+	return randomKey
+}
+
+// verificationPayload is what a verification token vouches for. Binding
+// the address means a token stops working once the email is changed.
+type verificationPayload struct {
+	UserID    uint   `json:"uid"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (s *UserService) signVerification(payload verificationPayload) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(raw)
+	mac := hmac.New(sha256.New, s.verificationKey)
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (s *UserService) parseVerification(token string) (*verificationPayload, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidVerificationToken
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	mac := hmac.New(sha256.New, s.verificationKey)
+	mac.Write([]byte(body))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	var payload verificationPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, ErrInvalidVerificationToken
+	}
+	return &payload, nil
+}
+
+// verifiedNow marks an address as verified on creation, for emails that a
+// sign-in provider has already verified.
+func verifiedNow(email string) *time.Time {
+	if email == "" {
+		return nil
+	}
+	now := time.Now()
+	return &now
+}
+
+// CreateEmailVerification issues a verification token for the user's
+// current email, at most once per EmailVerificationResendInterval.
+func (s *UserService) CreateEmailVerification(userID uint) (*model.User, string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user.Email == "" {
+		return nil, "", ErrNoEmail
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil, "", ErrEmailAlreadyVerified
+	}
+
+	// Claiming the send slot conditionally keeps concurrent requests from
+	// getting around the limit.
+	now := time.Now()
+	result := s.db.Model(&model.User{}).
+		Where("id = ? AND (email_verification_sent_at IS NULL OR email_verification_sent_at <= ?)",
+			user.ID, now.Add(-EmailVerificationResendInterval)).
+		Update("email_verification_sent_at", now)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		wait := EmailVerificationResendInterval
+		if user.EmailVerificationSentAt != nil {
+			wait = time.Until(user.EmailVerificationSentAt.Add(EmailVerificationResendInterval))
+		}
+		return nil, "", &VerificationTooSoonError{RetryAfter: wait}
+	}
+
+	token, err := s.signVerification(verificationPayload{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: now.Add(EmailVerificationTTL).Unix(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// VerifyEmail redeems a verification token. Verifying an address twice is
+// not an error.
+func (s *UserService) VerifyEmail(token string) (*model.User, error) {
+	payload, err := s.parseVerification(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserByID(payload.UserID)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	if !strings.EqualFold(user.Email, payload.Email) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+	// Several accounts may hold the same unverified address; the first to
+	// verify it gets it.
+	taken, err := s.emailTaken(user.Email, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailVerifiedElsewhere
+	}
+
+	now := time.Now()
+	if err := s.db.Model(user).Update("email_verified_at", now).Error; err != nil {
+		return nil, err
+	}
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"user/internal/model"
+	"user/internal/policy"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken            = errors.New("an account with this email already exists: sign in with your password and link this provider in account settings")
+	ErrGoogleLinkedElsewhere = errors.New("this Google account is linked to another user")
+	ErrGoogleAlreadyLinked   = errors.New("a Google account is already linked, unlink it first")
+	ErrGoogleNotLinked       = errors.New("no Google account is linked")
+	ErrLastLoginMethod       = errors.New("this is the only way to sign in to the account: set a password before unlinking it")
+)
+
+// GoogleIdentity is what the auth service learned from Google. Email is
+// only set when Google has verified it.
+type GoogleIdentity struct {
+	GoogleID string
+	Email    string
+	Name     string
+}
+
+func (s *UserService) getUserByGoogleID(googleID string) (*model.User, error) {
+	var user model.User
+	if err := s.db.Where("google_id = ?", googleID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// emailTaken reports whether another account has verified the address.
+// Unverified addresses do not count, so they cannot be squatted.
+func (s *UserService) emailTaken(email string, exceptID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.User{}).
+		Where("LOWER(email) = LOWER(?) AND id <> ? AND email_verified_at IS NOT NULL", email, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SignInWithGoogle finds the user linked to the Google identity, creating
+// one on first sign-in. It never merges into an existing account by email:
+// that account's owner has to link Google explicitly.
+func (s *UserService) SignInWithGoogle(identity GoogleIdentity) (*model.User, error) {
+	user, err := s.getUserByGoogleID(identity.GoogleID)
+	if err == nil {
+		if identity.Name != "" && identity.Name != user.Name {
+			if err := s.db.Model(user).Update("name", identity.Name).Error; err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if identity.Email != "" {
+		taken, err := s.emailTaken(identity.Email, 0)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrEmailTaken
+		}
+	}
+
+	username, err := s.freeUsername(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Google users have no password until they set one.
+	user = &model.User{
+		Username:        username,
+		GoogleID:        identity.GoogleID,
+		Email:           identity.Email,
+		EmailVerifiedAt: verifiedNow(identity.Email),
+		Name:            identity.Name,
+	}
+	if err := s.db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// freeUsername derives an unused username from the email's local part,
+// following the same rules as registration.
+func (s *UserService) freeUsername(email string) (string, error) {
+	base, _, _ := strings.Cut(strings.ToLower(email), "@")
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	base = strings.TrimLeft(base, "._-")
+	// Leave room for the "-xxxxxx" suffix.
+	if len(base) > policy.MaxUsernameLength-7 {
+		base = base[:policy.MaxUsernameLength-7]
+	}
+	if len(base) < policy.MinUsernameLength {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		taken, err := s.usernameTaken(candidate, 0)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("could not pick a free username")
+}
+
+// LinkGoogle attaches a Google identity to a signed-in user. The Google
+// email is copied over if the user has none and nobody else uses it.
+func (s *UserService) LinkGoogle(userID uint, identity GoogleIdentity) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.GoogleID == identity.GoogleID {
+		return nil
+	}
+	if user.GoogleID != "" {
+		return ErrGoogleAlreadyLinked
+	}
+
+	if _, err := s.getUserByGoogleID(identity.GoogleID); err == nil {
+		return ErrGoogleLinkedElsewhere
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	updates := map[string]interface{}{"google_id": identity.GoogleID}
+	if user.Email == "" && identity.Email != "" {
+		taken, err := s.emailTaken(identity.Email, user.ID)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			updates["email"] = identity.Email
+			updates["email_verified_at"] = time.Now()
+		}
+	}
+	if user.Name == "" && identity.Name != "" {
+		updates["name"] = identity.Name
+	}
+	return s.db.Model(user).Updates(updates).Error
+}
+
+// UnlinkGoogle removes the Google identity, unless it is the only way the
+// user can sign in.
+func (s *UserService) UnlinkGoogle(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.GoogleID == "" {
+		return ErrGoogleNotLinked
+	}
+	if user.Password == "" {
+		identities, err := s.countIdentities(user.ID)
+		if err != nil {
+			return err
+		}
+		if identities == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+	return s.db.Model(user).Update("google_id", "").Error
+}
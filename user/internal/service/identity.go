@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdentityLinkedElsewhere = errors.New("this provider account is linked to another user")
+	ErrProviderAlreadyLinked   = errors.New("an account at this provider is already linked, unlink it first")
+	ErrIdentityNotLinked       = errors.New("no account at this provider is linked")
+)
+
+// OIDCIdentity is a validated ID token from a configured OIDC provider.
+// Email is only set when the provider has verified it.
+type OIDCIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+}
+
+func (s *UserService) countIdentities(userID uint) (int64, error) {
+	var count int64
+	err := s.db.Model(&model.ExternalIdentity{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (s *UserService) getIdentity(provider, subject string) (*model.ExternalIdentity, error) {
+	var identity model.ExternalIdentity
+	if err := s.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// SignInWithOIDC works like SignInWithGoogle for any configured provider.
+func (s *UserService) SignInWithOIDC(identity OIDCIdentity) (*model.User, error) {
+	linked, err := s.getIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return s.GetUserByID(linked.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if identity.Email != "" {
+		taken, err := s.emailTaken(identity.Email, 0)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrEmailTaken
+		}
+	}
+
+	username, err := s.freeUsername(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		Username:        username,
+		Email:           identity.Email,
+		EmailVerifiedAt: verifiedNow(identity.Email),
+		Name:            identity.Name,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.ExternalIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkOIDC attaches a provider account to a signed-in user.
+func (s *UserService) LinkOIDC(userID uint, identity OIDCIdentity) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	linked, err := s.getIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.UserID == user.ID {
+			return nil
+		}
+		return ErrIdentityLinkedElsewhere
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var count int64
+	err = s.db.Model(&model.ExternalIdentity{}).
+		Where("user_id = ? AND provider = ?", user.ID, identity.Provider).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrProviderAlreadyLinked
+	}
+
+	return s.db.Create(&model.ExternalIdentity{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}).Error
+}
+
+// UnlinkOIDC removes the user's identity at a provider, unless the user
+// would be left without a way to sign in.
+func (s *UserService) UnlinkOIDC(userID uint, provider string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	var linked int64
+	err = s.db.Model(&model.ExternalIdentity{}).
+		Where("user_id = ? AND provider = ?", user.ID, provider).
+		Count(&linked).Error
+	if err != nil {
+		return err
+	}
+	if linked == 0 {
+		return ErrIdentityNotLinked
+	}
+
+	if user.Password == "" && user.GoogleID == "" {
+		identities, err := s.countIdentities(user.ID)
+		if err != nil {
+			return err
+		}
+		if identities <= 1 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	return s.db.Where("user_id = ? AND provider = ?", user.ID, provider).Delete(&model.ExternalIdentity{}).Error
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// LoginPolicy describes how failed logins are throttled. After a few free
+// attempts every further failure doubles the wait, starting at BaseDelay.
+// A username that reaches LockoutAfter failures is locked for LockoutDuration.
+// IPs only get backoff, with a higher allowance since they may be shared.
+type LoginPolicy struct {
+	UsernameBackoffAfter int
+	IPBackoffAfter       int
+	BaseDelay            time.Duration
+	MaxDelay             time.Duration
+	LockoutAfter         int
+	LockoutDuration      time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+var DefaultLoginPolicy = LoginPolicy{
+	UsernameBackoffAfter: 3,
+	IPBackoffAfter:       20,
+	BaseDelay:            time.Second,
+	MaxDelay:             5 * time.Minute,
+	LockoutAfter:         10,
+	LockoutDuration:      15 * time.Minute,
+	Window:               time.Hour,
+}
+
+// loginPolicy applies LOGIN_LOCKOUT_THRESHOLD and LOGIN_LOCKOUT_DURATION
+// on top of DefaultLoginPolicy.
+func loginPolicy() LoginPolicy {
+	policy := DefaultLoginPolicy
+
+	if value := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold <= 0 {
+			log.Printf("invalid LOGIN_LOCKOUT_THRESHOLD %q, using default %d", value, policy.LockoutAfter)
+		} else {
+			policy.LockoutAfter = threshold
+		}
+	}
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			log.Printf("invalid LOGIN_LOCKOUT_DURATION %q, using default %s", value, policy.LockoutDuration)
+		} else {
+			policy.LockoutDuration = duration
+		}
+	}
+	if policy.Window < policy.LockoutDuration {
+		policy.Window = policy.LockoutDuration
+	}
+	return policy
+}
+
+func (p LoginPolicy) backoff(failures, allowed int) time.Duration {
+	if failures < allowed {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := allowed; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// delay returns how long logins are blocked after the given number of
+// failures, and whether that amounts to an account lockout.
+func (p LoginPolicy) delay(kind string, failures int) (time.Duration, bool) {
+	if kind == model.ThrottleIP {
+		return p.backoff(failures, p.IPBackoffAfter), false
+	}
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration, true
+	}
+	return p.backoff(failures, p.UsernameBackoffAfter), false
+}
+
+func throttleKeys(username, ip string) map[string]string {
+	keys := map[string]string{model.ThrottleUsername: usernameKey(username)}
+	if ip != "" {
+		keys[model.ThrottleIP] = ip
+	}
+	return keys
+}
+
+func usernameKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// LoginRetryAfter reports how long the username or IP still has to wait
+// before the next login attempt; zero means the attempt may go ahead.
+func (s *UserService) LoginRetryAfter(username, ip string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for kind, key := range throttleKeys(username, ip) {
+		var throttle model.LoginThrottle
+		err := s.db.Where("kind = ? AND key = ?", kind, key).First(&throttle).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return 0, err
+		}
+		if throttle.BlockedUntil != nil && throttle.BlockedUntil.After(now) {
+			if left := throttle.BlockedUntil.Sub(now); left > wait {
+				wait = left
+			}
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed attempt against the username and IP.
+func (s *UserService) RecordLoginFailure(username, ip string) error {
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for kind, key := range throttleKeys(username, ip) {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&model.LoginThrottle{Kind: kind, Key: key, LastFailureAt: now}).Error
+			if err != nil {
+				return err
+			}
+
+			var throttle model.LoginThrottle
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("kind = ? AND key = ?", kind, key).
+				First(&throttle).Error
+			if err != nil {
+				return err
+			}
+
+			if now.Sub(throttle.LastFailureAt) > s.loginPolicy.Window {
+				throttle.Failures = 0
+			}
+			throttle.Failures++
+			throttle.LastFailureAt = now
+
+			delay, lockout := s.loginPolicy.delay(kind, throttle.Failures)
+			if delay > 0 {
+				until := now.Add(delay)
+				throttle.BlockedUntil = &until
+			}
+			if lockout {
+				log.Printf("login for %q locked for %s after %d failed attempts", key, delay, throttle.Failures)
+			}
+			if err := tx.Save(&throttle).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ResetLoginFailures forgets the username's failures after a successful
+// login. IP counters are left to expire, so one valid account cannot be
+// used to keep resetting them.
+func (s *UserService) ResetLoginFailures(username string) error {
+	return s.db.Where("kind = ? AND key = ?", model.ThrottleUsername, usernameKey(username)).
+		Delete(&model.LoginThrottle{}).Error
+}
+
+// LoginThrottles returns the failure counters of the given users, keyed by
+// user ID, for the admin user list.
+func (s *UserService) LoginThrottles(users []model.User) (map[uint]model.LoginThrottle, error) {
+	ids := make(map[string]uint, len(users))
+	keys := make([]string, 0, len(users))
+	for _, user := range users {
+		key := usernameKey(user.Username)
+		ids[key] = user.ID
+		keys = append(keys, key)
+	}
+
+	var throttles []model.LoginThrottle
+	err := s.db.Where("kind = ? AND key IN ?", model.ThrottleUsername, keys).
+		Where("last_failure_at > ?", time.Now().Add(-s.loginPolicy.Window)).
+		Find(&throttles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]model.LoginThrottle, len(throttles))
+	for _, throttle := range throttles {
+		result[ids[throttle.Key]] = throttle
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"user/internal/model"
+)
+
+func TestLoginPolicyDelay(t *testing.T) {
+	p := LoginPolicy{
+		UsernameBackoffAfter: 3,
+		IPBackoffAfter:       20,
+		BaseDelay:            time.Second,
+		MaxDelay:             10 * time.Second,
+		LockoutAfter:         10,
+		LockoutDuration:      15 * time.Minute,
+	}
+
+	tests := []struct {
+		kind       string
+		failures   int
+		want       time.Duration
+		wantLocked bool
+	}{
+		{model.ThrottleUsername, 0, 0, false},
+		{model.ThrottleUsername, 2, 0, false},
+		{model.ThrottleUsername, 3, time.Second, false},
+		{model.ThrottleUsername, 4, 2 * time.Second, false},
+		{model.ThrottleUsername, 6, 8 * time.Second, false},
+		{model.ThrottleUsername, 7, 10 * time.Second, false},
+		{model.ThrottleUsername, 9, 10 * time.Second, false},
+		{model.ThrottleUsername, 10, 15 * time.Minute, true},
+		{model.ThrottleUsername, 50, 15 * time.Minute, true},
+		{model.ThrottleIP, 19, 0, false},
+		{model.ThrottleIP, 20, time.Second, false},
+		{model.ThrottleIP, 22, 4 * time.Second, false},
+		// IPs are never locked out, and the doubling stops at MaxDelay.
+		{model.ThrottleIP, 1000, 10 * time.Second, false},
+	}
+	for _, tt := range tests {
+		got, locked := p.delay(tt.kind, tt.failures)
+		if got != tt.want || locked != tt.wantLocked {
+			t.Errorf("delay(%s, %d) = %s, %v; want %s, %v", tt.kind, tt.failures, got, locked, tt.want, tt.wantLocked)
+		}
+	}
+}
+
+func TestLoginPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		threshold, duration string
+		wantAfter           int
+		wantDuration        time.Duration
+		wantWindow          time.Duration
+	}{
+		{"", "", DefaultLoginPolicy.LockoutAfter, DefaultLoginPolicy.LockoutDuration, DefaultLoginPolicy.Window},
+		{"5", "30m", 5, 30 * time.Minute, DefaultLoginPolicy.Window},
+		// Failures must be remembered for at least as long as a lockout.
+		{"5", "2h", 5, 2 * time.Hour, 2 * time.Hour},
+		{"0", "soon", DefaultLoginPolicy.LockoutAfter, DefaultLoginPolicy.LockoutDuration, DefaultLoginPolicy.Window},
+		{"-1", "-5m", DefaultLoginPolicy.LockoutAfter, DefaultLoginPolicy.LockoutDuration, DefaultLoginPolicy.Window},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOGIN_LOCKOUT_THRESHOLD", tt.threshold)
+		t.Setenv("LOGIN_LOCKOUT_DURATION", tt.duration)
+		p := loginPolicy()
+		if p.LockoutAfter != tt.wantAfter || p.LockoutDuration != tt.wantDuration || p.Window != tt.wantWindow {
+			t.Errorf("threshold %q duration %q: got %d, %s, window %s", tt.threshold, tt.duration, p.LockoutAfter, p.LockoutDuration, p.Window)
+		}
+	}
+}
+
+func TestThrottleKeys(t *testing.T) {
+	keys := throttleKeys("  Alice ", "10.0.0.1")
+	if len(keys) != 2 || keys[model.ThrottleUsername] != "alice" || keys[model.ThrottleIP] != "10.0.0.1" {
+		t.Errorf("throttleKeys = %v", keys)
+	}
+	if keys := throttleKeys("alice", ""); len(keys) != 1 {
+		t.Errorf("without an IP: %v", keys)
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PasswordResetTTL = time.Hour
+	// PasswordResetResendInterval limits how often reset mail goes to one
+	// account.
+	PasswordResetResendInterval = time.Minute
+	// At most PasswordResetIPLimit reset requests are accepted from one IP
+	// per PasswordResetIPWindow, whatever the usernames.
+	PasswordResetIPLimit  = 10
+	PasswordResetIPWindow = time.Hour
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrResetTooSoon      = errors.New("a reset email was sent recently")
+)
+
+// ResetLimitError is returned when an IP has used up its reset requests
+// for the current window.
+type ResetLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResetLimitError) Error() string {
+	return "too many password reset requests, try again later"
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ChangePassword sets a new password after checking the current one.
+func (s *UserService) ChangePassword(userID uint, oldPassword, newPassword string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" || !comparePassword(user.Password, oldPassword) {
+		return ErrInvalidCredentials
+	}
+	if err := s.passwordPolicy.Check("new_password", newPassword, user.Username); err != nil {
+		return err
+	}
+
+	hashed, err := s.hashPassword(newPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", hashed).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, user.ID)
+	})
+}
+
+// CreatePasswordResetToken issues a reset token for the user. The plain
+// token is returned once and only its hash is kept. Requests are limited
+// per IP, and per account to one every PasswordResetResendInterval.
+func (s *UserService) CreatePasswordResetToken(username, ip string) (*model.User, string, error) {
+	if err := s.countResetRequest(ip); err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return nil, "", err
+	}
+	// The token is mailed, and mail only goes to verified addresses.
+	if user.Email == "" || user.EmailVerifiedAt == nil {
+		return nil, "", ErrEmailNotVerified
+	}
+
+	// Claiming the send slot conditionally keeps concurrent requests from
+	// getting around the limit.
+	now := time.Now()
+	result := s.db.Model(&model.User{}).
+		Where("id = ? AND (password_reset_sent_at IS NULL OR password_reset_sent_at <= ?)",
+			user.ID, now.Add(-PasswordResetResendInterval)).
+		Update("password_reset_sent_at", now)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", ErrResetTooSoon
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	reset := model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(PasswordResetTTL),
+	}
+	if err := s.db.Create(&reset).Error; err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// countResetRequest counts a reset request against the client IP and
+// refuses it once the IP is over PasswordResetIPLimit for the window.
+func (s *UserService) countResetRequest(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.PasswordResetThrottle{IP: ip, WindowStart: now}).Error
+		if err != nil {
+			return err
+		}
+
+		var throttle model.PasswordResetThrottle
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ip = ?", ip).First(&throttle).Error
+		if err != nil {
+			return err
+		}
+
+		if now.Sub(throttle.WindowStart) >= PasswordResetIPWindow {
+			throttle.WindowStart = now
+			throttle.Requests = 0
+		}
+		if throttle.Requests >= PasswordResetIPLimit {
+			return &ResetLimitError{RetryAfter: throttle.WindowStart.Add(PasswordResetIPWindow).Sub(now)}
+		}
+		throttle.Requests++
+		return tx.Save(&throttle).Error
+	})
+}
+
+// ResetPassword redeems a reset token. The token and every other pending
+// token of the same user become unusable.
+func (s *UserService) ResetPassword(token, newPassword string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var reset model.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+			First(&reset).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+
+		var user model.User
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return err
+		}
+		// Checked before the token is claimed, so a rejected password does
+		// not burn the token.
+		if err := s.passwordPolicy.Check("new_password", newPassword, user.Username); err != nil {
+			return err
+		}
+		hashed, err := s.hashPassword(newPassword)
+		if err != nil {
+			return errors.New("failed to hash password")
+		}
+
+		// Claiming the token conditionally keeps two concurrent redemptions
+		// from both succeeding.
+		now := time.Now()
+		result := tx.Model(&reset).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		err = tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.User{}).Where("id = ?", reset.UserID).Update("password", hashed).Error; err != nil {
+			return err
+		}
+		return revokeAllSessions(tx, reset.UserID)
+	})
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	_ "time/tzdata" // the service image has no zoneinfo
+	"unicode/utf8"
+	"user/internal/model"
+	"user/internal/policy"
+
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MaxNameLength      = 100
+	MaxAvatarURLLength = 2048
+)
+
+// ProfileUpdate holds the fields of a PATCH /me request; nil fields are
+// left unchanged and empty strings clear the field.
+type ProfileUpdate struct {
+	Username  *string
+	Name      *string
+	Email     *string
+	Timezone  *string
+	Locale    *string
+	AvatarURL *string
+}
+
+// GetProfile returns an active user: locked accounts and accounts waiting
+// for deletion are reported as missing.
+func (s *UserService) GetProfile(userID uint) (*model.User, error) {
+	var user model.User
+	if err := s.db.Where("deletion_due_at IS NULL AND locked_at IS NULL").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateProfile validates the update and applies it in one transaction,
+// writing only the fields it changes. All field violations are returned
+// together as a *policy.ValidationError.
+func (s *UserService) UpdateProfile(userID uint, update ProfileUpdate) (*model.User, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("deletion_due_at IS NULL AND locked_at IS NULL").
+			First(&user, userID).Error
+		if err != nil {
+			return err
+		}
+
+		changes, err := s.profileChanges(&user, update)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		if err := tx.Model(&user).Updates(changes).Error; err != nil {
+			// A concurrent update may have won the username index.
+			if username, ok := changes["username"].(string); ok {
+				if taken, _ := s.usernameTaken(username, user.ID); taken {
+					return errUsernameTaken
+				}
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProfile(userID)
+}
+
+// profileChanges validates the update against the user and returns the
+// columns to write.
+func (s *UserService) profileChanges(user *model.User, update ProfileUpdate) (map[string]interface{}, error) {
+	errs := &policy.ValidationError{}
+	changes := map[string]interface{}{}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if utf8.RuneCountInString(name) > MaxNameLength {
+			errs.Add("name", policy.CodeTooLong, "name is too long")
+		}
+		changes["name"] = name
+	}
+
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		if email != "" {
+			if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+				errs.Add("email", policy.CodeInvalid, "email is not a valid address")
+			} else if taken, err := s.emailTaken(email, user.ID); err != nil {
+				return nil, err
+			} else if taken {
+				errs.Add("email", policy.CodeTaken, "email is already used by another account")
+			}
+		}
+		changes["email"] = email
+		// A new address has to be verified again.
+		if !strings.EqualFold(email, user.Email) {
+			changes["email_verified_at"] = nil
+			changes["email_verification_sent_at"] = nil
+		}
+	}
+
+	if update.Timezone != nil {
+		timezone := strings.TrimSpace(*update.Timezone)
+		if timezone != "" {
+			if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+				errs.Add("timezone", policy.CodeInvalid, "timezone must be an IANA name such as Europe/Moscow")
+			}
+		}
+		changes["timezone"] = timezone
+	}
+
+	if update.Locale != nil {
+		locale := strings.TrimSpace(*update.Locale)
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				errs.Add("locale", policy.CodeInvalid, "locale must be a BCP 47 tag such as ru-RU")
+			} else {
+				locale = tag.String()
+			}
+		}
+		changes["locale"] = locale
+	}
+
+	if update.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*update.AvatarURL)
+		if avatarURL != "" {
+			u, err := url.Parse(avatarURL)
+			switch {
+			case len(avatarURL) > MaxAvatarURLLength:
+				errs.Add("avatar_url", policy.CodeTooLong, "avatar URL is too long")
+			case err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "":
+				errs.Add("avatar_url", policy.CodeInvalid, "avatar URL must be an http(s) URL")
+			}
+		}
+		changes["avatar_url"] = avatarURL
+	}
+
+	if update.Username != nil && *update.Username != user.Username {
+		if err := policy.CheckUsername("username", *update.Username); err != nil {
+			errs.Merge(err)
+		} else if taken, err := s.usernameTaken(*update.Username, user.ID); err != nil {
+			return nil, err
+		} else if taken {
+			errs.Merge(errUsernameTaken)
+		}
+		changes["username"] = *update.Username
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
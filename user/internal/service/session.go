@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SessionTTL = 30 * 24 * time.Hour
+	// LoginTicketTTL only has to cover the auth service's call to
+	// CreateSession right after the login.
+	LoginTicketTTL = time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidLoginTicket  = errors.New("invalid or expired login ticket")
+	ErrSessionInactive     = errors.New("session is revoked or expired")
+)
+
+// refreshAction is what presenting a refresh token leads to.
+type refreshAction int
+
+const (
+	// refreshRotate exchanges the token for a new one.
+	refreshRotate refreshAction = iota
+	// refreshRevoke ends the session: the token was already used, so it
+	// has leaked.
+	refreshRevoke
+)
+
+// checkRefresh decides what to do with a presented refresh token. An error
+// rejects the request and leaves the session as it is.
+func checkRefresh(refresh *model.RefreshToken, session *model.Session, user *model.User, now time.Time) (refreshAction, error) {
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return 0, ErrInvalidRefreshToken
+	}
+	if user.LockedAt != nil {
+		return 0, ErrAccountLocked
+	}
+	if refresh.UsedAt != nil {
+		return refreshRevoke, nil
+	}
+	return refreshRotate, nil
+}
+
+func issueRefreshToken(tx *gorm.DB, sessionID uint) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	refresh := model.RefreshToken{SessionID: sessionID, TokenHash: hashToken(token)}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IssueLoginTicket is called once a login has fully succeeded. The ticket
+// lets the auth service open exactly one session for the user.
+func (s *UserService) IssueLoginTicket(userID uint) (string, error) {
+	ticket, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Tickets of logins that never reached CreateSession are dropped here.
+		if err := tx.Where("user_id = ? AND expires_at <= ?", userID, now).Delete(&model.LoginTicket{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.LoginTicket{
+			TicketHash: hashToken(ticket),
+			UserID:     userID,
+			ExpiresAt:  now.Add(LoginTicketTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// useLoginTicket consumes a ticket issued to the user. Deleting it in the
+// check makes it single use even under concurrent calls.
+func useLoginTicket(tx *gorm.DB, userID uint, ticket string, now time.Time) error {
+	result := tx.Where("ticket_hash = ? AND user_id = ? AND expires_at > ?", hashToken(ticket), userID, now).
+		Delete(&model.LoginTicket{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrInvalidLoginTicket
+	}
+	return nil
+}
+
+// CreateSession starts a new session for a user who has just logged in and
+// returns its first refresh token. ticket is the one the login issued.
+func (s *UserService) CreateSession(userID uint, ticket, userAgent, ip string) (*model.Session, string, error) {
+	now := time.Now()
+	session := model.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+
+	var token string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useLoginTicket(tx, userID, ticket, now); err != nil {
+			return err
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		token, err = issueRefreshToken(tx, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &session, token, nil
+}
+
+// RefreshSession rotates a refresh token. Each token can be exchanged once;
+// if a used token comes back, it was leaked, so the session is revoked.
+func (s *UserService) RefreshSession(token string) (*model.Session, string, error) {
+	var (
+		session  model.Session
+		newToken string
+		reused   bool
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var refresh model.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(token)).
+			First(&refresh).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if err := tx.First(&session, refresh.SessionID).Error; err != nil {
+			return err
+		}
+		var user model.User
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		action, err := checkRefresh(&refresh, &session, &user, now)
+		if err != nil {
+			return err
+		}
+		if action == refreshRevoke {
+			reused = true
+			return tx.Model(&session).Update("revoked_at", now).Error
+		}
+
+		if err := tx.Model(&refresh).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(SessionTTL)
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		newToken, err = issueRefreshToken(tx, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reused {
+		return nil, "", ErrRefreshTokenReused
+	}
+	return &session, newToken, nil
+}
+
+// RevokeSession ends one of the user's sessions.
+func (s *UserService) RevokeSession(userID, sessionID uint) error {
+	result := s.db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RequireSession checks that sessionID is an active session of the user,
+// for calls made on the user's behalf.
+func (s *UserService) RequireSession(userID, sessionID uint) error {
+	var count int64
+	err := s.db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionInactive
+	}
+	return nil
+}
+
+// revokeAllSessions logs the user out everywhere, e.g. after a password change.
+func revokeAllSessions(tx *gorm.DB, userID uint) error {
+	return tx.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (s *UserService) ListSessions(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
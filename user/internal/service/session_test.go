@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"user/internal/model"
+)
+
+func TestCheckRefresh(t *testing.T) {
+	now := time.Date(2030, time.May, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Minute)
+	live := model.Session{ExpiresAt: now.Add(time.Hour)}
+
+	tests := []struct {
+		name    string
+		refresh model.RefreshToken
+		session model.Session
+		user    model.User
+		want    refreshAction
+		wantErr error
+	}{
+		{
+			name:    "fresh token rotates",
+			session: live,
+			want:    refreshRotate,
+		},
+		{
+			name:    "used token revokes the session",
+			refresh: model.RefreshToken{UsedAt: &earlier},
+			session: live,
+			want:    refreshRevoke,
+		},
+		{
+			name:    "expired session",
+			session: model.Session{ExpiresAt: earlier},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:    "expires exactly now",
+			session: model.Session{ExpiresAt: now},
+			want:    refreshRotate,
+		},
+		{
+			name:    "revoked session",
+			session: model.Session{ExpiresAt: now.Add(time.Hour), RevokedAt: &earlier},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			// Reuse of a token from an already revoked session is not
+			// reported again; the session is simply dead.
+			name:    "used token of a revoked session",
+			refresh: model.RefreshToken{UsedAt: &earlier},
+			session: model.Session{ExpiresAt: now.Add(time.Hour), RevokedAt: &earlier},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:    "locked user",
+			session: live,
+			user:    model.User{LockedAt: &earlier},
+			wantErr: ErrAccountLocked,
+		},
+		{
+			// A locked account keeps its sessions, so a leaked token cannot
+			// be used to revoke them while it is locked.
+			name:    "used token of a locked user",
+			refresh: model.RefreshToken{UsedAt: &earlier},
+			session: live,
+			user:    model.User{LockedAt: &earlier},
+			wantErr: ErrAccountLocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkRefresh(&tt.refresh, &tt.session, &tt.user, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("action = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := newToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != 64 {
+			t.Fatalf("token %q has %d characters, want 64", token, len(token))
+		}
+		if seen[token] {
+			t.Fatalf("token %q issued twice", token)
+		}
+		seen[token] = true
+
+		hash := hashToken(token)
+		if hash == token || hash != hashToken(token) || len(hash) != 64 {
+			t.Fatalf("hashToken(%q) = %q", token, hash)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+	"user/internal/model"
+
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	TOTPIssuer = "Tasker"
+
+	totpPeriod = 30
+	// totpSkew is how many time steps either side of now are accepted, to
+	// allow for clock drift between server and phone.
+	totpSkew = 1
+
+	RecoveryCodeCount = 10
+	recoveryCodeLen   = 10
+	// Unambiguous lowercase characters, so codes are easy to copy by hand.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrTOTPAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled      = errors.New("two-factor enrollment has not been started")
+	ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// TwoFactorEnabled reports whether the user must pass a second factor to log in.
+func TwoFactorEnabled(user *model.User) bool {
+	return user.TOTPEnabledAt != nil
+}
+
+// EnrollTOTP starts enrollment by generating a new secret for the user. It
+// only takes effect after ConfirmTOTP, so restarting enrollment is harmless.
+func (s *UserService) EnrollTOTP(userID uint) (secret, uri string, err error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if TwoFactorEnabled(user) {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.db.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    key.Secret(),
+		"totp_last_step": 0,
+	}).Error
+	if err != nil {
+		return "", "", err
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator works, and returns a fresh set of recovery codes. The plain
+// codes are returned once and only their hashes are kept.
+func (s *UserService) ConfirmTOTP(userID uint, code string) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if TwoFactorEnabled(user) {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useTOTPCode(tx, user, code); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It requires the password,
+// if the account has one, and a current code or an unused recovery code.
+func (s *UserService) DisableTOTP(userID uint, password, code string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !TwoFactorEnabled(user) {
+		return ErrTOTPNotEnabled
+	}
+	if user.Password != "" && !comparePassword(user.Password, password) {
+		return ErrInvalidCredentials
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useSecondFactor(tx, user, code); err != nil {
+			return err
+		}
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// VerifySecondFactor checks the second step of a login. The code is either
+// a TOTP code or one of the user's recovery codes, which is then used up.
+func (s *UserService) VerifySecondFactor(userID uint, code string) (*model.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !TwoFactorEnabled(user) {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return useSecondFactor(tx, user, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func useSecondFactor(tx *gorm.DB, user *model.User, code string) error {
+	err := useTOTPCode(tx, user, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return useRecoveryCode(tx, user.ID, code)
+	}
+	return err
+}
+
+// useTOTPCode accepts a code from the current time step or its neighbours.
+// Steps are consumed, so a code that was already accepted cannot be replayed.
+func useTOTPCode(tx *gorm.DB, user *model.User, code string) error {
+	step, err := matchTOTPStep(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if err != nil {
+		return err
+	}
+
+	result := tx.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// matchTOTPStep returns the time step within totpSkew of now whose code is
+// code. Steps up to lastStep were already used and never match.
+func matchTOTPStep(secret, code string, now time.Time, lastStep int64) (int64, error) {
+	code = strings.TrimSpace(code)
+	current := now.Unix() / totpPeriod
+
+	for step := current + totpSkew; step >= current-totpSkew; step-- {
+		if step <= lastStep {
+			break
+		}
+		expected, err := totp.GenerateCode(secret, time.Unix(step*totpPeriod, 0))
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidTwoFactorCode
+}
+
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLen {
+		return ErrInvalidTwoFactorCode
+	}
+
+	result := tx.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	rows := make([]model.RecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLen/2]+"-"+code[recoveryCodeLen/2:])
+		rows = append(rows, model.RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// 256 is not a multiple of the alphabet size, but the bias is negligible
+	// for codes that are random, single-use and hashed.
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// normalizeRecoveryCode accepts codes typed with or without the dash and
+// in any case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
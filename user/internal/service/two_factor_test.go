@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestMatchTOTPStep(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_900_000_005, 0)
+	current := now.Unix() / totpPeriod
+
+	codeAt := func(step int64) string {
+		code, err := totp.GenerateCode(secret, time.Unix(step*totpPeriod, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		want     int64
+		wantErr  bool
+	}{
+		{name: "current step", code: codeAt(current), want: current},
+		{name: "surrounding spaces", code: " " + codeAt(current) + "\n", want: current},
+		{name: "previous step", code: codeAt(current - 1), want: current - 1},
+		{name: "next step", code: codeAt(current + 1), want: current + 1},
+		{name: "two steps behind", code: codeAt(current - 2), wantErr: true},
+		{name: "two steps ahead", code: codeAt(current + 2), wantErr: true},
+		{name: "replayed", code: codeAt(current), lastStep: current, wantErr: true},
+		{name: "older than the last used", code: codeAt(current - 1), lastStep: current, wantErr: true},
+		{name: "newer than the last used", code: codeAt(current + 1), lastStep: current, want: current + 1},
+		{name: "garbage", code: "12345", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, err := matchTOTPStep(secret, tt.code, now, tt.lastStep)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTwoFactorCode) {
+					t.Fatalf("step %d, error %v; want ErrInvalidTwoFactorCode", step, err)
+				}
+				return
+			}
+			if err != nil || step != tt.want {
+				t.Errorf("step %d, error %v; want %d", step, err, tt.want)
+			}
+		})
+	}
+}
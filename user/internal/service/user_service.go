@@ -5,26 +5,38 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"user/internal/model"
+	"user/internal/policy"
 )
 
 type UserService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	hashCost       int
+	loginPolicy    LoginPolicy
+	passwordPolicy policy.PasswordPolicy
+	// verificationKey signs email verification tokens.
+	verificationKey []byte
 }
 
 func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+	return &UserService{
+		db:              db,
+		hashCost:        passwordCost(),
+		loginPolicy:     loginPolicy(),
+		passwordPolicy:  policy.PasswordPolicyFromEnv(),
+		verificationKey: verificationSecret(),
+	}
 }
 
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (s *UserService) hashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.hashCost)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-func comparePassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(password), []byte(hash))
+func comparePassword(hash, password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
@@ -36,39 +48,77 @@ func (s *UserService) GetUserByID(userID uint) (*model.User, error) {
 	return &user, nil
 }
 
-func (s *UserService) CheckByID(userID uint) (bool, error) {
-	var user model.User
-	if err := s.db.First(&user, userID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return false, nil
-		}
-		return false, errors.New("database error")
+// MaxBatchSize caps the number of IDs in one GetUsersByIDs call.
+const MaxBatchSize = 500
+
+var (
+	ErrTooManyIDs = errors.New("too many user IDs in one request")
+	// ErrAmbiguousUsername means the name matches, in a different case,
+	// several accounts created before usernames became case-insensitive.
+	ErrAmbiguousUsername = errors.New("username matches several accounts in different case, enter it exactly")
+)
+
+// GetUsersByIDs loads users in any state, ordered by ID. Unknown IDs are
+// skipped.
+func (s *UserService) GetUsersByIDs(ids []uint) ([]model.User, error) {
+	if len(ids) > MaxBatchSize {
+		return nil, ErrTooManyIDs
+	}
+	users := make([]model.User, 0, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := s.db.Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		return nil, err
 	}
-	return true, nil
+	return users, nil
 }
 
-func (s *UserService) CreateUser(user *model.User) (uint, error) {
-	if user.Username == "" {
-		return 0, errors.New("empty username")
+// errUsernameTaken is returned as a field error, like the policy checks.
+var errUsernameTaken = policy.Field("username", policy.CodeTaken, "username is already taken")
+
+// usernameTaken checks uniqueness ignoring case, so "Alice" and "alice"
+// cannot both register.
+func (s *UserService) usernameTaken(username string, exceptID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.User{}).
+		Where("LOWER(username) = LOWER(?) AND id <> ?", username, exceptID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
 	}
-	if user.Password == "" {
-		return 0, errors.New("empty password")
+	return count > 0, nil
+}
+
+// CreateUser registers a password user. Username and password violations
+// are returned together as a *policy.ValidationError.
+func (s *UserService) CreateUser(user *model.User) (uint, error) {
+	errs := &policy.ValidationError{}
+	errs.Merge(policy.CheckUsername("username", user.Username))
+	errs.Merge(s.passwordPolicy.Check("password", user.Password, user.Username))
+	if err := errs.Err(); err != nil {
+		return 0, err
 	}
 
-	var existing model.User
-	if err := s.db.Where("username = ?", user.Username).First(&existing).Error; err == nil {
-		return 0, errors.New("username taken")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+	taken, err := s.usernameTaken(user.Username, 0)
+	if err != nil {
 		return 0, errors.New("database error")
 	}
+	if taken {
+		return 0, errUsernameTaken
+	}
 
-	hashedPassword, err := hashPassword(user.Password)
+	hashedPassword, err := s.hashPassword(user.Password)
 	if err != nil {
 		return 0, errors.New("failed to hash password")
 	}
 	user.Password = hashedPassword
 
 	if err := s.db.Create(user).Error; err != nil {
+		// A concurrent registration may have won the unique index.
+		if taken, _ := s.usernameTaken(user.Username, 0); taken {
+			return 0, errUsernameTaken
+		}
 		return 0, err
 	}
 
@@ -86,29 +136,69 @@ func (s *UserService) DeleteUser(userID uint) error {
 	return nil
 }
 
+// UpdateUser changes the username and/or password. Both go through the
+// same rules as registration.
 func (s *UserService) UpdateUser(userID uint, updateUser *model.User) error {
 	var user model.User
 	if err := s.db.First(&user, userID).Error; err != nil {
 		return err
 	}
 
-	if updateUser.Username != "" {
+	if updateUser.Username != "" && updateUser.Username != user.Username {
+		if err := policy.CheckUsername("username", updateUser.Username); err != nil {
+			return err
+		}
+		taken, err := s.usernameTaken(updateUser.Username, user.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errUsernameTaken
+		}
 		user.Username = updateUser.Username
 	}
 	if updateUser.Password != "" {
-		hashedPassword, err := hashPassword(updateUser.Password)
+		if err := s.passwordPolicy.Check("password", updateUser.Password, user.Username); err != nil {
+			return err
+		}
+		hashedPassword, err := s.hashPassword(updateUser.Password)
 		if err != nil {
 			return errors.New("failed to hash password")
 		}
 		user.Password = hashedPassword
 	}
 
-	return s.db.Save(&user).Error
+	if err := s.db.Save(&user).Error; err != nil {
+		if taken, _ := s.usernameTaken(user.Username, user.ID); taken {
+			return errUsernameTaken
+		}
+		return err
+	}
+	return nil
 }
+
+// GetUserByUsername finds a user regardless of case. While old accounts
+// still collide in case, an exact match wins and anything else is
+// ErrAmbiguousUsername rather than an arbitrary one of them.
 func (s *UserService) GetUserByUsername(username string) (*model.User, error) {
-	var user model.User
-	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+	var users []model.User
+	if err := s.db.Where("LOWER(username) = LOWER(?)", username).Find(&users).Error; err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return pickUsername(users, username)
+}
+
+func pickUsername(users []model.User, username string) (*model.User, error) {
+	for i := range users {
+		if users[i].Username == username {
+			return &users[i], nil
+		}
+	}
+	switch len(users) {
+	case 0:
+		return nil, gorm.ErrRecordNotFound
+	case 1:
+		return &users[0], nil
+	}
+	return nil, ErrAmbiguousUsername
 }
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"user/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestPickUsername(t *testing.T) {
+	alice := model.User{ID: 1, Username: "Alice"}
+	aliceLower := model.User{ID: 2, Username: "alice"}
+
+	tests := []struct {
+		name     string
+		users    []model.User
+		username string
+		wantID   uint
+		wantErr  error
+	}{
+		{"no match", nil, "alice", 0, gorm.ErrRecordNotFound},
+		{"single match in other case", []model.User{alice}, "ALICE", 1, nil},
+		{"exact match among collisions", []model.User{alice, aliceLower}, "alice", 2, nil},
+		{"collisions without exact match", []model.User{alice, aliceLower}, "ALICE", 0, ErrAmbiguousUsername},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := pickUsername(tt.users, tt.username)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.ID != tt.wantID {
+				t.Errorf("picked user %d, want %d", user.ID, tt.wantID)
+			}
+		})
+	}
+}
@@ -1,75 +1,29 @@
 package middleware
 
 import (
-	"errors"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"log"
+	"jwtauth"
 	"net/http"
-	"os"
-	"strings"
 )
 
-var jwtSecret []byte
-
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
-	}
-	jwtSecret = []byte(secret)
-}
-
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(verifier *jwtauth.Verifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Authorization header required"})
-			return
-		}
-
-		const prefix = "Bearer "
-		if !strings.HasPrefix(authHeader, prefix) {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Authorization header must be in 'Bearer <token>' format"})
+		tokenString, err := jwtauth.BearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, prefix)
-		userID, err := parseToken(tokenString)
+		claims, err := verifier.Parse(tokenString)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
+		userID, _ := claims.UserID()
 
 		// Сохраняем userID в context
 		c.Set("userID", userID)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
-
-func parseToken(tokenString string) (uint, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
-	if err != nil {
-		return 0, err
-	}
-
-	if !token.Valid {
-		return 0, errors.New("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("invalid token claims")
-	}
-
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		return 0, errors.New("user_id missing or not a number")
-	}
-	return uint(userIDFloat), nil
-}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"user/pkg/auth_user_pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequireServiceToken lets AuthService calls through only if they carry
+// "authorization: Bearer <token>". The AuthService acts for whatever user
+// a request names, so only the auth service, which holds the token, may
+// call it. The read-only UserService stays open to the internal network.
+func RequireServiceToken(token string) grpc.UnaryServerInterceptor {
+	prefix := "/" + auth_user_pb.AuthService_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, prefix) && !hasServiceToken(ctx, token) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid service token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func hasServiceToken(ctx context.Context, token string) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
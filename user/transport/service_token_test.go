@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequireServiceToken(t *testing.T) {
+	interceptor := RequireServiceToken("s3cret")
+	handler := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		name   string
+		method string
+		header []string
+		want   codes.Code
+	}{
+		{"auth call with the token", "/user.AuthService/CreateSession", []string{"Bearer s3cret"}, codes.OK},
+		{"auth call without a token", "/user.AuthService/CreateSession", nil, codes.Unauthenticated},
+		{"auth call with a wrong token", "/user.AuthService/LinkGoogle", []string{"Bearer guess"}, codes.Unauthenticated},
+		{"bare token", "/user.AuthService/Login", []string{"s3cret"}, codes.Unauthenticated},
+		{"user service call", "/user.UserService/GetUser", nil, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.header[0]))
+			}
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"errors"
+	"math"
+	"time"
+	"user/internal/policy"
+	"user/internal/service"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gorm.io/gorm"
+)
+
+// errorDomain is the ErrorInfo domain of all errors sent by this service.
+const errorDomain = "user"
+
+// knownErrors maps service errors to a status code and the ErrorInfo
+// reason the auth service passes on to clients.
+var knownErrors = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{service.ErrInvalidCredentials, codes.Unauthenticated, "INVALID_CREDENTIALS"},
+	{service.ErrInvalidTwoFactorCode, codes.Unauthenticated, "INVALID_TWO_FACTOR_CODE"},
+	{service.ErrInvalidRefreshToken, codes.Unauthenticated, "INVALID_REFRESH_TOKEN"},
+	{service.ErrRefreshTokenReused, codes.Unauthenticated, "REFRESH_TOKEN_REUSED"},
+	{service.ErrInvalidLoginTicket, codes.Unauthenticated, "INVALID_LOGIN_TICKET"},
+	{service.ErrSessionInactive, codes.Unauthenticated, "SESSION_INACTIVE"},
+	{service.ErrInvalidResetToken, codes.InvalidArgument, "INVALID_RESET_TOKEN"},
+	{service.ErrInvalidVerificationToken, codes.InvalidArgument, "INVALID_VERIFICATION_TOKEN"},
+	{service.ErrAccountLocked, codes.PermissionDenied, "ACCOUNT_LOCKED"},
+	{service.ErrAccountPendingDeletion, codes.PermissionDenied, "ACCOUNT_PENDING_DELETION"},
+	{service.ErrAdminRequired, codes.PermissionDenied, "ADMIN_REQUIRED"},
+	{service.ErrReauthRequired, codes.PermissionDenied, "REAUTHENTICATION_REQUIRED"},
+	{service.ErrEmailTaken, codes.AlreadyExists, "EMAIL_TAKEN"},
+	{service.ErrEmailVerifiedElsewhere, codes.AlreadyExists, "EMAIL_TAKEN"},
+	{service.ErrGoogleLinkedElsewhere, codes.AlreadyExists, "IDENTITY_LINKED_ELSEWHERE"},
+	{service.ErrIdentityLinkedElsewhere, codes.AlreadyExists, "IDENTITY_LINKED_ELSEWHERE"},
+	{service.ErrGoogleAlreadyLinked, codes.AlreadyExists, "PROVIDER_ALREADY_LINKED"},
+	{service.ErrProviderAlreadyLinked, codes.AlreadyExists, "PROVIDER_ALREADY_LINKED"},
+	{service.ErrTOTPAlreadyEnabled, codes.AlreadyExists, "TWO_FACTOR_ALREADY_ENABLED"},
+	{service.ErrGoogleNotLinked, codes.NotFound, "IDENTITY_NOT_LINKED"},
+	{service.ErrIdentityNotLinked, codes.NotFound, "IDENTITY_NOT_LINKED"},
+	{service.ErrSessionNotFound, codes.NotFound, "SESSION_NOT_FOUND"},
+	{gorm.ErrRecordNotFound, codes.NotFound, "USER_NOT_FOUND"},
+	{service.ErrLastLoginMethod, codes.FailedPrecondition, "LAST_LOGIN_METHOD"},
+	{service.ErrTOTPNotEnrolled, codes.FailedPrecondition, "TWO_FACTOR_NOT_ENROLLED"},
+	{service.ErrTOTPNotEnabled, codes.FailedPrecondition, "TWO_FACTOR_NOT_ENABLED"},
+	{service.ErrNoEmail, codes.FailedPrecondition, "NO_EMAIL"},
+	{service.ErrEmailAlreadyVerified, codes.FailedPrecondition, "EMAIL_ALREADY_VERIFIED"},
+	{service.ErrAccountNotPending, codes.FailedPrecondition, "ACCOUNT_NOT_PENDING_DELETION"},
+	{service.ErrAccountNotLocked, codes.FailedPrecondition, "ACCOUNT_NOT_LOCKED"},
+	{service.ErrCannotLockSelf, codes.FailedPrecondition, "CANNOT_LOCK_SELF"},
+	{service.ErrTooManyIDs, codes.InvalidArgument, "TOO_MANY_IDS"},
+	{service.ErrAmbiguousUsername, codes.FailedPrecondition, "AMBIGUOUS_USERNAME"},
+}
+
+// newStatus builds a status error carrying an ErrorInfo and any extra
+// details.
+func newStatus(code codes.Code, reason, message string, details ...protoadapt.MessageV1) error {
+	details = append([]protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}}, details...)
+	st, err := status.New(code, message).WithDetails(details...)
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// statusError converts a service error into a gRPC status error. Errors it
+// does not know are returned unchanged and reach the caller as Unknown.
+func statusError(err error) error {
+	var verr *policy.ValidationError
+	if errors.As(err, &verr) {
+		return validationStatus(verr)
+	}
+	var tooSoon *service.VerificationTooSoonError
+	if errors.As(err, &tooSoon) {
+		return throttledStatus("EMAIL_VERIFICATION_TOO_SOON", err.Error(), tooSoon.RetryAfter)
+	}
+	var resetLimit *service.ResetLimitError
+	if errors.As(err, &resetLimit) {
+		return throttledStatus("TOO_MANY_RESET_REQUESTS", err.Error(), resetLimit.RetryAfter)
+	}
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			message := err.Error()
+			if known.err == gorm.ErrRecordNotFound {
+				message = "user not found"
+			}
+			return newStatus(known.code, known.reason, message)
+		}
+	}
+	return err
+}
+
+// validationStatus reports broken field rules as InvalidArgument, or as
+// AlreadyExists if the only problem is a taken username or email.
+func validationStatus(verr *policy.ValidationError) error {
+	code := codes.AlreadyExists
+	reason := "ALREADY_EXISTS"
+	badRequest := &errdetails.BadRequest{}
+	for _, fe := range verr.Errors {
+		if fe.Code != policy.CodeTaken {
+			code = codes.InvalidArgument
+			reason = "VALIDATION_FAILED"
+		}
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Reason:      fe.Code,
+			Description: fe.Message,
+		})
+	}
+	return newStatus(code, reason, verr.Error(), badRequest)
+}
+
+// throttledStatus is ResourceExhausted with a RetryInfo rounded up to
+// whole seconds.
+func throttledStatus(reason, message string, wait time.Duration) error {
+	delay := time.Duration(math.Ceil(wait.Seconds())) * time.Second
+	return newStatus(codes.ResourceExhausted, reason, message, &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+}
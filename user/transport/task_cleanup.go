@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"time"
+	"user/internal/service"
+	"user/pkg/taskpb"
+)
+
+// RunAccountPurger periodically purges accounts whose deletion grace period
+// is over and asks the task service to delete their tasks. Failed cleanups
+// stay queued and are retried on the next tick.
+func RunAccountPurger(ctx context.Context, s *service.UserService, taskClient taskpb.TaskServiceClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purgeAccounts(ctx, s, taskClient)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeAccounts(ctx context.Context, s *service.UserService, taskClient taskpb.TaskServiceClient) {
+	purged, err := s.PurgeDueAccounts()
+	if err != nil {
+		log.Printf("failed to purge accounts: %v", err)
+	} else if purged > 0 {
+		log.Printf("purged %d accounts", purged)
+	}
+
+	userIDs, err := s.PendingTaskCleanups()
+	if err != nil {
+		log.Printf("failed to load pending task cleanups: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		resp, err := taskClient.DeleteUserTasks(reqCtx, &taskpb.DeleteUserTasksRequest{UserId: uint64(userID)})
+		cancel()
+		if err != nil {
+			log.Printf("failed to delete tasks of user %d: %v", userID, err)
+			continue
+		}
+
+		if err := s.CompleteTaskCleanup(userID); err != nil {
+			log.Printf("failed to complete task cleanup for user %d: %v", userID, err)
+			continue
+		}
+		log.Printf("deleted %d tasks of user %d", resp.DeletedTasks, userID)
+	}
+}
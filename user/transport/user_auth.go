@@ -3,20 +3,25 @@ package transport
 import (
 	"context"
 	"errors"
+	"google.golang.org/grpc/codes"
 	"gorm.io/gorm"
+	"time"
 	"user/internal/model"
+	"user/internal/notify"
 	"user/internal/service"
 	"user/pkg/auth_user_pb"
 )
 
 type UserAuthServer struct {
 	auth_user_pb.AuthServiceServer
-	s *service.UserService
+	s        *service.UserService
+	notifier notify.Notifier
 }
 
-func NewUserAuthServer(db *gorm.DB) *UserAuthServer {
+func NewUserAuthServer(db *gorm.DB, notifier notify.Notifier) *UserAuthServer {
 	return &UserAuthServer{
-		s: service.NewUserService(db),
+		s:        service.NewUserService(db),
+		notifier: notifier,
 	}
 }
 
@@ -28,78 +33,472 @@ func (serv *UserAuthServer) Register(ctx context.Context, req *auth_user_pb.Regi
 
 	id, err := serv.s.CreateUser(&user)
 	if err != nil {
-		return &auth_user_pb.RegisterResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, statusError(err)
 	}
 
 	return &auth_user_pb.RegisterResponse{
-		Id:      uint64(id),
-		Success: true,
-		Error:   "",
+		Id: uint64(id),
 	}, nil
 }
 
+// activeUser rejects sign-ins to accounts that are locked or waiting for
+// deletion.
+func activeUser(user *model.User) error {
+	if user.DeletionDueAt != nil {
+		return statusError(service.ErrAccountPendingDeletion)
+	}
+	if user.LockedAt != nil {
+		return statusError(service.ErrAccountLocked)
+	}
+	return nil
+}
+
 func (serv *UserAuthServer) Login(ctx context.Context, req *auth_user_pb.LoginRequest) (*auth_user_pb.LoginResponse, error) {
-	user, err := serv.s.GetUserByUsername(req.Username)
+	wait, err := serv.s.LoginRetryAfter(req.Username, req.Ip)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return &auth_user_pb.LoginResponse{
-				Success: false,
-				Error:   "user not found",
-			}, nil
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, throttledStatus("TOO_MANY_ATTEMPTS", service.ErrTooManyAttempts.Error(), wait)
+	}
+
+	user, err := serv.s.VerifyCredentials(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			if err := serv.s.RecordLoginFailure(req.Username, req.Ip); err != nil {
+				return nil, err
+			}
 		}
-		return &auth_user_pb.LoginResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, statusError(err)
+	}
+
+	if err := activeUser(user); err != nil {
+		return nil, err
 	}
 
-	if user.Password != req.Password {
-		return &auth_user_pb.LoginResponse{
-			Success: false,
-			Error:   "invalid password",
-		}, nil
+	// With 2FA the counters are only reset once the second step passes,
+	// so knowing the password does not help to guess codes.
+	if service.TwoFactorEnabled(user) {
+		return &auth_user_pb.LoginResponse{Id: uint64(user.ID), TwoFactorRequired: true}, nil
+	}
+	if err := serv.s.ResetLoginFailures(req.Username); err != nil {
+		return nil, err
 	}
 
+	ticket, err := serv.s.IssueLoginTicket(user.ID)
+	if err != nil {
+		return nil, err
+	}
 	return &auth_user_pb.LoginResponse{
-		Id:      uint64(user.ID),
-		Success: true,
-		Error:   "",
+		Id:          uint64(user.ID),
+		LoginTicket: ticket,
 	}, nil
 }
 
+// loginTicket issues the ticket for a login that needs no second step.
+func (serv *UserAuthServer) loginTicket(user *model.User) (string, error) {
+	if service.TwoFactorEnabled(user) {
+		return "", nil
+	}
+	return serv.s.IssueLoginTicket(user.ID)
+}
+
 func (serv *UserAuthServer) LoginWithGoogle(ctx context.Context, req *auth_user_pb.GoogleLoginRequest) (*auth_user_pb.GoogleLoginResponse, error) {
-	user, err := serv.s.GetUserByUsername(req.Email)
+	user, err := serv.s.SignInWithGoogle(service.GoogleIdentity{
+		GoogleID: req.GoogleId,
+		Email:    req.Email,
+		Name:     req.Name,
+	})
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			newUser := model.User{
-				Username: req.Email,
-				Password: "",
-			}
-			id, createErr := serv.s.CreateUser(&newUser)
-			if createErr != nil {
-				return &auth_user_pb.GoogleLoginResponse{
-					Success: false,
-					Error:   createErr.Error(),
-				}, nil
+		return nil, statusError(err)
+	}
+
+	if err := activeUser(user); err != nil {
+		return nil, err
+	}
+
+	ticket, err := serv.loginTicket(user)
+	if err != nil {
+		return nil, err
+	}
+	return &auth_user_pb.GoogleLoginResponse{
+		Id:                uint64(user.ID),
+		TwoFactorRequired: service.TwoFactorEnabled(user),
+		LoginTicket:       ticket,
+	}, nil
+}
+
+func (serv *UserAuthServer) LinkGoogle(ctx context.Context, req *auth_user_pb.LinkGoogleRequest) (*auth_user_pb.LinkGoogleResponse, error) {
+	if err := serv.s.RequireSession(uint(req.UserId), uint(req.SessionId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	err := serv.s.LinkGoogle(uint(req.UserId), service.GoogleIdentity{
+		GoogleID: req.GoogleId,
+		Email:    req.Email,
+		Name:     req.Name,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.LinkGoogleResponse{}, nil
+}
+
+func (serv *UserAuthServer) UnlinkGoogle(ctx context.Context, req *auth_user_pb.UnlinkGoogleRequest) (*auth_user_pb.UnlinkGoogleResponse, error) {
+	err := serv.s.UnlinkGoogle(uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.UnlinkGoogleResponse{}, nil
+}
+
+func (serv *UserAuthServer) LoginWithOIDC(ctx context.Context, req *auth_user_pb.OIDCLoginRequest) (*auth_user_pb.OIDCLoginResponse, error) {
+	user, err := serv.s.SignInWithOIDC(service.OIDCIdentity{
+		Provider: req.Provider,
+		Subject:  req.Subject,
+		Email:    req.Email,
+		Name:     req.Name,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	if err := activeUser(user); err != nil {
+		return nil, err
+	}
+
+	ticket, err := serv.loginTicket(user)
+	if err != nil {
+		return nil, err
+	}
+	return &auth_user_pb.OIDCLoginResponse{
+		Id:                uint64(user.ID),
+		TwoFactorRequired: service.TwoFactorEnabled(user),
+		LoginTicket:       ticket,
+	}, nil
+}
+
+func (serv *UserAuthServer) LinkOIDC(ctx context.Context, req *auth_user_pb.LinkOIDCRequest) (*auth_user_pb.LinkOIDCResponse, error) {
+	if err := serv.s.RequireSession(uint(req.UserId), uint(req.SessionId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	err := serv.s.LinkOIDC(uint(req.UserId), service.OIDCIdentity{
+		Provider: req.Provider,
+		Subject:  req.Subject,
+		Email:    req.Email,
+		Name:     req.Name,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.LinkOIDCResponse{}, nil
+}
+
+func (serv *UserAuthServer) UnlinkOIDC(ctx context.Context, req *auth_user_pb.UnlinkOIDCRequest) (*auth_user_pb.UnlinkOIDCResponse, error) {
+	err := serv.s.UnlinkOIDC(uint(req.UserId), req.Provider)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.UnlinkOIDCResponse{}, nil
+}
+
+func (serv *UserAuthServer) EnrollTOTP(ctx context.Context, req *auth_user_pb.EnrollTOTPRequest) (*auth_user_pb.EnrollTOTPResponse, error) {
+	if err := serv.s.RequireSession(uint(req.UserId), uint(req.SessionId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	secret, uri, err := serv.s.EnrollTOTP(uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    uri,
+	}, nil
+}
+
+func (serv *UserAuthServer) ConfirmTOTP(ctx context.Context, req *auth_user_pb.ConfirmTOTPRequest) (*auth_user_pb.ConfirmTOTPResponse, error) {
+	recoveryCodes, err := serv.s.ConfirmTOTP(uint(req.UserId), req.Code)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.ConfirmTOTPResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+func (serv *UserAuthServer) DisableTOTP(ctx context.Context, req *auth_user_pb.DisableTOTPRequest) (*auth_user_pb.DisableTOTPResponse, error) {
+	err := serv.s.DisableTOTP(uint(req.UserId), req.Password, req.Code)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.DisableTOTPResponse{}, nil
+}
+
+func (serv *UserAuthServer) VerifyTwoFactor(ctx context.Context, req *auth_user_pb.VerifyTwoFactorRequest) (*auth_user_pb.VerifyTwoFactorResponse, error) {
+	user, err := serv.s.GetUserByID(uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	wait, err := serv.s.LoginRetryAfter(user.Username, req.Ip)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, throttledStatus("TOO_MANY_ATTEMPTS", service.ErrTooManyAttempts.Error(), wait)
+	}
+
+	if _, err := serv.s.VerifySecondFactor(user.ID, req.Code); err != nil {
+		if errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			if err := serv.s.RecordLoginFailure(user.Username, req.Ip); err != nil {
+				return nil, err
 			}
-			return &auth_user_pb.GoogleLoginResponse{
-				Id:      uint64(id),
-				Success: true,
-				Error:   "",
-			}, nil
 		}
-		return &auth_user_pb.GoogleLoginResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, statusError(err)
 	}
 
-	return &auth_user_pb.GoogleLoginResponse{
-		Id:      uint64(user.ID),
-		Success: true,
-		Error:   "",
+	// The account may have been locked or scheduled for deletion since the
+	// first step of the login.
+	if err := activeUser(user); err != nil {
+		return nil, err
+	}
+
+	if err := serv.s.ResetLoginFailures(user.Username); err != nil {
+		return nil, err
+	}
+
+	ticket, err := serv.s.IssueLoginTicket(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &auth_user_pb.VerifyTwoFactorResponse{LoginTicket: ticket}, nil
+}
+
+func (serv *UserAuthServer) SendEmailVerification(ctx context.Context, req *auth_user_pb.SendEmailVerificationRequest) (*auth_user_pb.SendEmailVerificationResponse, error) {
+	user, token, err := serv.s.CreateEmailVerification(uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	if err := serv.notifier.SendEmailVerification(user, token); err != nil {
+		return nil, err
+	}
+
+	return &auth_user_pb.SendEmailVerificationResponse{}, nil
+}
+
+func (serv *UserAuthServer) VerifyEmail(ctx context.Context, req *auth_user_pb.VerifyEmailRequest) (*auth_user_pb.VerifyEmailResponse, error) {
+	user, err := serv.s.VerifyEmail(req.Token)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.VerifyEmailResponse{
+		UserId: uint64(user.ID),
 	}, nil
 }
+
+func (serv *UserAuthServer) ChangePassword(ctx context.Context, req *auth_user_pb.ChangePasswordRequest) (*auth_user_pb.ChangePasswordResponse, error) {
+	if err := serv.s.RequireSession(uint(req.Id), uint(req.SessionId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	err := serv.s.ChangePassword(uint(req.Id), req.OldPassword, req.NewPassword)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.ChangePasswordResponse{}, nil
+}
+
+func (serv *UserAuthServer) RequestPasswordReset(ctx context.Context, req *auth_user_pb.RequestPasswordResetRequest) (*auth_user_pb.RequestPasswordResetResponse, error) {
+	user, token, err := serv.s.CreatePasswordResetToken(req.Username, req.Ip)
+	if err != nil {
+		// No mail is sent, but the answer must not tell these cases apart
+		// from a sent one.
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrAmbiguousUsername) ||
+			errors.Is(err, service.ErrEmailNotVerified) || errors.Is(err, service.ErrResetTooSoon) {
+			return &auth_user_pb.RequestPasswordResetResponse{}, nil
+		}
+		return nil, statusError(err)
+	}
+
+	if err := serv.notifier.SendPasswordReset(user, token); err != nil {
+		return nil, err
+	}
+
+	return &auth_user_pb.RequestPasswordResetResponse{}, nil
+}
+
+func (serv *UserAuthServer) ResetPassword(ctx context.Context, req *auth_user_pb.ResetPasswordRequest) (*auth_user_pb.ResetPasswordResponse, error) {
+	err := serv.s.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.ResetPasswordResponse{}, nil
+}
+
+func (serv *UserAuthServer) DeleteAccount(ctx context.Context, req *auth_user_pb.DeleteAccountRequest) (*auth_user_pb.DeleteAccountResponse, error) {
+	due, err := serv.s.ScheduleDeletion(uint(req.Id), uint(req.SessionId), req.Password, req.Code)
+	if err != nil {
+		// Here it is the state the request conflicts with, not a reason to
+		// refuse the caller.
+		if errors.Is(err, service.ErrAccountPendingDeletion) {
+			return nil, newStatus(codes.FailedPrecondition, "ACCOUNT_PENDING_DELETION", err.Error())
+		}
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.DeleteAccountResponse{
+		DeletionDueAt: due.Unix(),
+	}, nil
+}
+
+func (serv *UserAuthServer) RestoreAccount(ctx context.Context, req *auth_user_pb.RestoreAccountRequest) (*auth_user_pb.RestoreAccountResponse, error) {
+	user, err := serv.s.RestoreAccount(req.Username, req.Password)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.RestoreAccountResponse{
+		Id: uint64(user.ID),
+	}, nil
+}
+
+func (serv *UserAuthServer) CreateSession(ctx context.Context, req *auth_user_pb.CreateSessionRequest) (*auth_user_pb.CreateSessionResponse, error) {
+	user, err := serv.s.GetUserByID(uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	session, token, err := serv.s.CreateSession(user.ID, req.LoginTicket, req.UserAgent, req.Ip)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.CreateSessionResponse{
+		SessionId:     uint64(session.ID),
+		RefreshToken:  token,
+		Roles:         service.Roles(user),
+		EmailVerified: user.EmailVerifiedAt != nil,
+	}, nil
+}
+
+func (serv *UserAuthServer) RefreshSession(ctx context.Context, req *auth_user_pb.RefreshSessionRequest) (*auth_user_pb.RefreshSessionResponse, error) {
+	session, token, err := serv.s.RefreshSession(req.RefreshToken)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	// Roles and the email flag are re-read on every refresh, so changes
+	// reach the access tokens within one token lifetime.
+	user, err := serv.s.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth_user_pb.RefreshSessionResponse{
+		UserId:        uint64(session.UserID),
+		SessionId:     uint64(session.ID),
+		RefreshToken:  token,
+		Roles:         service.Roles(user),
+		EmailVerified: user.EmailVerifiedAt != nil,
+	}, nil
+}
+
+func (serv *UserAuthServer) RevokeSession(ctx context.Context, req *auth_user_pb.RevokeSessionRequest) (*auth_user_pb.RevokeSessionResponse, error) {
+	err := serv.s.RevokeSession(uint(req.UserId), uint(req.SessionId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.RevokeSessionResponse{}, nil
+}
+
+func (serv *UserAuthServer) ListSessions(ctx context.Context, req *auth_user_pb.ListSessionsRequest) (*auth_user_pb.ListSessionsResponse, error) {
+	sessions, err := serv.s.ListSessions(uint(req.UserId))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &auth_user_pb.ListSessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &auth_user_pb.Session{
+			Id:         uint64(session.ID),
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastUsedAt: session.LastUsedAt.Unix(),
+			ExpiresAt:  session.ExpiresAt.Unix(),
+		})
+	}
+	return resp, nil
+}
+
+func (serv *UserAuthServer) ListUsers(ctx context.Context, req *auth_user_pb.ListUsersRequest) (*auth_user_pb.ListUsersResponse, error) {
+	users, err := serv.s.ListUsers(uint(req.ActorId), req.Query, uint(req.AfterId), int(req.Limit))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	throttles, err := serv.s.LoginThrottles(users)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &auth_user_pb.ListUsersResponse{}
+	for _, user := range users {
+		pbUser := &auth_user_pb.User{
+			Id:       uint64(user.ID),
+			Username: user.Username,
+			Email:    user.Email,
+			Name:     user.Name,
+			Role:     string(user.Role),
+		}
+		if user.LockedAt != nil {
+			pbUser.LockedAt = user.LockedAt.Unix()
+		}
+		if user.DeletionDueAt != nil {
+			pbUser.DeletionDueAt = user.DeletionDueAt.Unix()
+		}
+		if throttle, ok := throttles[user.ID]; ok {
+			pbUser.FailedLogins = int32(throttle.Failures)
+			if throttle.BlockedUntil != nil && throttle.BlockedUntil.After(time.Now()) {
+				pbUser.LoginBlockedUntil = throttle.BlockedUntil.Unix()
+			}
+		}
+		resp.Users = append(resp.Users, pbUser)
+	}
+	return resp, nil
+}
+
+func (serv *UserAuthServer) LockUser(ctx context.Context, req *auth_user_pb.LockUserRequest) (*auth_user_pb.LockUserResponse, error) {
+	err := serv.s.LockUser(uint(req.ActorId), uint(req.UserId), req.Reason)
+	if err != nil {
+		if errors.Is(err, service.ErrAccountLocked) {
+			return nil, newStatus(codes.FailedPrecondition, "ACCOUNT_ALREADY_LOCKED", err.Error())
+		}
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.LockUserResponse{}, nil
+}
+
+func (serv *UserAuthServer) UnlockUser(ctx context.Context, req *auth_user_pb.UnlockUserRequest) (*auth_user_pb.UnlockUserResponse, error) {
+	err := serv.s.UnlockUser(uint(req.ActorId), uint(req.UserId))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &auth_user_pb.UnlockUserResponse{}, nil
+}
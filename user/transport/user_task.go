@@ -2,10 +2,14 @@ package transport
 
 import (
 	"context"
-	"strconv"
+	"errors"
+	"user/internal/model"
 	"user/internal/service"
 	"user/pkg/userpb"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -20,19 +24,135 @@ func NewUserServiceServer(db *gorm.DB) *UserServiceServer {
 	}
 }
 
+func userStatus(user *model.User) userpb.UserStatus {
+	switch {
+	case user.DeletionDueAt != nil:
+		return userpb.UserStatus_USER_STATUS_PENDING_DELETION
+	case user.LockedAt != nil:
+		return userpb.UserStatus_USER_STATUS_LOCKED
+	default:
+		return userpb.UserStatus_USER_STATUS_ACTIVE
+	}
+}
+
+func toUserMessage(user *model.User) *userpb.UserInfo {
+	return &userpb.UserInfo{
+		Id:          uint64(user.ID),
+		Username:    user.Username,
+		DisplayName: user.Name,
+		Email:       user.Email,
+		Status:      userStatus(user),
+		Roles:       service.Roles(user),
+	}
+}
+
 func (s *UserServiceServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.GetUserResponse, error) {
-	userID64, err := strconv.ParseUint(req.Id, 10, 64)
+	user, err := s.userService.GetUserByID(uint(req.Id))
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &userpb.GetUserResponse{Exists: false}, nil
+		}
 		return nil, err
 	}
-	userID := uint(userID64)
 
-	exists, err := s.userService.CheckByID(userID)
+	msg := toUserMessage(user)
+	return &userpb.GetUserResponse{
+		Exists: msg.Status == userpb.UserStatus_USER_STATUS_ACTIVE,
+		User:   msg,
+	}, nil
+}
+
+func (s *UserServiceServer) BatchGetUsers(ctx context.Context, req *userpb.BatchGetUsersRequest) (*userpb.BatchGetUsersResponse, error) {
+	ids := make([]uint, 0, len(req.Ids))
+	for _, id := range req.Ids {
+		ids = append(ids, uint(id))
+	}
+
+	users, err := s.userService.GetUsersByIDs(ids)
 	if err != nil {
 		return nil, err
 	}
 
-	return &userpb.GetUserResponse{
-		Exists: exists,
+	resp := &userpb.BatchGetUsersResponse{Users: make([]*userpb.UserInfo, 0, len(users))}
+	for i := range users {
+		resp.Users = append(resp.Users, toUserMessage(&users[i]))
+	}
+	return resp, nil
+}
+
+var changeKinds = map[service.ChangeKind]userpb.UserChangeKind{
+	service.ChangeLocked:            userpb.UserChangeKind_USER_CHANGE_KIND_LOCKED,
+	service.ChangeUnlocked:          userpb.UserChangeKind_USER_CHANGE_KIND_UNLOCKED,
+	service.ChangeDeletionScheduled: userpb.UserChangeKind_USER_CHANGE_KIND_DELETION_SCHEDULED,
+	service.ChangeRestored:          userpb.UserChangeKind_USER_CHANGE_KIND_RESTORED,
+	service.ChangeDeleted:           userpb.UserChangeKind_USER_CHANGE_KIND_DELETED,
+}
+
+// WatchUserChanges forwards user status changes until the caller hangs up.
+// A caller that cannot keep up is disconnected with Aborted and has to
+// assume it missed changes.
+func (s *UserServiceServer) WatchUserChanges(req *userpb.WatchUserChangesRequest, stream grpc.ServerStreamingServer[userpb.UserChange]) error {
+	changes, unsubscribe := s.userService.SubscribeUserChanges()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.Aborted, "too far behind on user changes, reconnect")
+			}
+			err := stream.Send(&userpb.UserChange{
+				UserId: uint64(change.UserID),
+				Kind:   changeKinds[change.Kind],
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *UserServiceServer) GetUserByUsername(ctx context.Context, req *userpb.GetUserByUsernameRequest) (*userpb.GetUserByUsernameResponse, error) {
+	user, err := s.userService.GetUserByUsername(req.Username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &userpb.GetUserByUsernameResponse{Exists: false}, nil
+		}
+		return nil, statusError(err)
+	}
+
+	// As in GetUser, only active users exist for the task service, so
+	// tasks cannot be shared with locked or leaving accounts.
+	if userStatus(user) != userpb.UserStatus_USER_STATUS_ACTIVE {
+		return &userpb.GetUserByUsernameResponse{Exists: false}, nil
+	}
+	return &userpb.GetUserByUsernameResponse{
+		Exists: true,
+		Id:     uint64(user.ID),
+	}, nil
+}
+
+func (s *UserServiceServer) GetUserProfile(ctx context.Context, req *userpb.GetUserProfileRequest) (*userpb.GetUserProfileResponse, error) {
+	user, err := s.userService.GetProfile(uint(req.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &userpb.GetUserProfileResponse{Exists: false}, nil
+		}
+		return nil, err
+	}
+
+	return &userpb.GetUserProfileResponse{
+		Exists: true,
+		Profile: &userpb.UserProfile{
+			Id:        uint64(user.ID),
+			Username:  user.Username,
+			Name:      user.Name,
+			Email:     user.Email,
+			Timezone:  user.Timezone,
+			Locale:    user.Locale,
+			AvatarUrl: user.AvatarURL,
+		},
 	}, nil
 }